@@ -34,7 +34,12 @@ func CreateComment(actorID, text string) {
 }
 
 func GetActorsByFilter(formID string, key, val string) map[string]any {
-	req := "https://api.control.events/v/1.0/actors_filters/" + formID + "?limit=200&offset=0"
+	return GetActorsByFilterPage(formID, key, val, 200, 0)
+}
+
+func GetActorsByFilterPage(formID string, key, val string, limit, offset int) map[string]any {
+	req := "https://api.control.events/v/1.0/actors_filters/" + formID +
+		"?limit=" + strconv.Itoa(limit) + "&offset=" + strconv.Itoa(offset)
 	if key != "" {
 		req += "&q=" + key + "%3D" + val
 	}
@@ -174,7 +179,8 @@ func GetTypeLinks(accID string) map[string]any {
 	return do("https://api.control.events/v/1.0/edge_types/"+accID, "GET", map[string]any{}, true)
 }
 
-func CreateLink(edgeTypeID int, wid, source, target string) string {
+// CreateLink links source to target. name and data are left out when empty.
+func CreateLink(edgeTypeID int, wid, source, target, name string, linkData map[string]any) string {
 	if target == "" {
 		return ""
 	}
@@ -185,6 +191,12 @@ func CreateLink(edgeTypeID int, wid, source, target string) string {
 
 		"curveStyle": "curved",
 	}
+	if name != "" {
+		req["name"] = name
+	}
+	if linkData != nil {
+		req["data"] = linkData
+	}
 	rsp := do("https://api.control.events/v/1.0/actors/link/"+wid, "POST", req, true)
 	data := rsp["data"].(map[string]any)
 	id := data["id"].(string)
@@ -192,7 +204,7 @@ func CreateLink(edgeTypeID int, wid, source, target string) string {
 
 }
 
-func CreateActor(ref, title string, formIDInt int, formData map[string]any, rgba *color.RGBA, pictureObject map[string]any, picture string) string {
+func CreateActor(ref, title, description string, formIDInt int, formData map[string]any, rgba *color.RGBA, pictureObject map[string]any, picture string) string {
 	formID := strconv.Itoa(formIDInt)
 	if ref == "" {
 		ref = strconv.Itoa(int(time.Now().UnixNano()))
@@ -201,7 +213,7 @@ func CreateActor(ref, title string, formIDInt int, formData map[string]any, rgba
 	req := map[string]any{
 		"ref":         ref,
 		"title":       title,
-		"description": "",
+		"description": description,
 		"picture":     picture,
 		"data":        formData,
 	}
@@ -238,6 +250,12 @@ func CustomForms(wid string) map[string]any {
 	return do("https://api.control.events/v/1.0/forms/templates/"+wid, "GET", map[string]any{}, true)
 }
 
+// GetForm loads the form formIDInt with its sections.
+func GetForm(formIDInt int) map[string]any {
+	formID := strconv.Itoa(formIDInt)
+	return do("https://api.control.events/v/1.0/forms/"+formID, "GET", map[string]any{}, true)
+}
+
 func GetActor(id string) map[string]any {
 	return do("https://api.control.events/v/1.0/actors/"+id, "GET", map[string]any{}, true)
 }
@@ -257,6 +275,17 @@ func UpdateNameActor(title, ID, formID string) {
 	return
 }
 
+func UpdateActor(formIDInt int, ID, title string, formData map[string]any) {
+	formID := strconv.Itoa(formIDInt)
+	req := map[string]any{
+		"data": formData,
+	}
+	if title != "" {
+		req["title"] = title
+	}
+	do("https://api.control.events/v/1.0/actors/actor/"+formID+"/"+ID, "PUT", req, true)
+}
+
 //
 
 func UpdateColorActor(rgba *color.RGBA, title, ID, formID string) {
@@ -285,7 +314,7 @@ func CreateImageActor(file io.Reader, wid string, formID int, fileName string, h
 		"type":   "image",
 		"width":  width,
 	}
-	id := CreateActor("", fileName, formID, data, nil, pictureObject, "")
+	id := CreateActor("", fileName, "", formID, data, nil, pictureObject, "")
 	AddToLayer("node", id, layerID, int(x), int(y))
 	return id
 }
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SchemaLimits are the structured output limits a schema has to fit in.
+type SchemaLimits struct {
+	MaxProperties   int `json:"max_properties"`
+	MaxDepth        int `json:"max_depth"`
+	MaxEnumValues   int `json:"max_enum_values"`
+	MaxStringLength int `json:"max_string_length"`
+}
+
+// defaultSchemaLimits are the OpenAI Structured Outputs limits.
+var defaultSchemaLimits = SchemaLimits{
+	MaxProperties:   5000,
+	MaxDepth:        10,
+	MaxEnumValues:   1000,
+	MaxStringLength: 120000,
+}
+
+// withDefaults fills unset limits from defaultSchemaLimits.
+func (l SchemaLimits) withDefaults() SchemaLimits {
+	if l.MaxProperties <= 0 {
+		l.MaxProperties = defaultSchemaLimits.MaxProperties
+	}
+	if l.MaxDepth <= 0 {
+		l.MaxDepth = defaultSchemaLimits.MaxDepth
+	}
+	if l.MaxEnumValues <= 0 {
+		l.MaxEnumValues = defaultSchemaLimits.MaxEnumValues
+	}
+	if l.MaxStringLength <= 0 {
+		l.MaxStringLength = defaultSchemaLimits.MaxStringLength
+	}
+	return l
+}
+
+// SchemaStats is the size of a schema as measured against SchemaLimits.
+// StringLength sums property names, enum values and option titles.
+type SchemaStats struct {
+	Properties   int `json:"properties"`
+	Depth        int `json:"depth"`
+	EnumValues   int `json:"enum_values"`
+	StringLength int `json:"string_length"`
+}
+
+func measureSchema(schema SchemaProperty) SchemaStats {
+	var stats SchemaStats
+	measure(schema, 1, &stats)
+	return stats
+}
+
+func measure(schema SchemaProperty, depth int, stats *SchemaStats) {
+	if depth > stats.Depth {
+		stats.Depth = depth
+	}
+	for name, property := range schema.Properties {
+		stats.Properties++
+		stats.StringLength += len(name)
+		measure(property, depth+1, stats)
+	}
+	if schema.Items != nil {
+		measure(*schema.Items, depth+1, stats)
+	}
+	for _, branch := range schema.AnyOf {
+		measure(branch, depth, stats)
+	}
+	if schema.Enum != nil {
+		stats.EnumValues += len(*schema.Enum)
+		for _, v := range *schema.Enum {
+			stats.StringLength += len(v)
+		}
+	}
+	if schema.OneOf != nil {
+		for _, o := range *schema.OneOf {
+			stats.StringLength += len(fmt.Sprint(o.Const)) + len(o.Title)
+		}
+	}
+}
+
+// exceeded lists the limits stats goes over.
+func (l SchemaLimits) exceeded(stats SchemaStats) []string {
+	var over []string
+	if stats.Properties > l.MaxProperties {
+		over = append(over, fmt.Sprintf("%d properties > %d", stats.Properties, l.MaxProperties))
+	}
+	if stats.Depth > l.MaxDepth {
+		over = append(over, fmt.Sprintf("depth %d > %d", stats.Depth, l.MaxDepth))
+	}
+	if stats.EnumValues > l.MaxEnumValues {
+		over = append(over, fmt.Sprintf("%d enum values > %d", stats.EnumValues, l.MaxEnumValues))
+	}
+	if stats.StringLength > l.MaxStringLength {
+		over = append(over, fmt.Sprintf("string length %d > %d", stats.StringLength, l.MaxStringLength))
+	}
+	return over
+}
+
+// SchemaPart is one of the sequential schemas a form is split into.
+type SchemaPart struct {
+	Sections []string       `json:"sections"`
+	Schema   SchemaProperty `json:"schema"`
+	Stats    SchemaStats    `json:"stats"`
+}
+
+// BudgetReport tells what fitSchema had to do to stay within the limits.
+type BudgetReport struct {
+	Limits  SchemaLimits `json:"limits"`
+	Actions []string     `json:"actions"`
+}
+
+// fitSchema converts the form and makes it fit opts.Limits. Oversized option
+// lists are trimmed first; if the schema is still too large the form is split
+// into several sequential schemas by section, and sections that do not fit
+// on their own are split by field.
+func fitSchema(f Form, opts SchemaOptions) ([]SchemaPart, BudgetReport, []Diagnostic, error) {
+	conv := newConversion(opts)
+	report := BudgetReport{Limits: opts.Limits.withDefaults(), Actions: make([]string, 0)}
+	// Every build runs in its own fork: trial builds must not add diagnostics.
+	// Pieces keep the section key of the whole form, so the answers to every
+	// part map back onto it in NestSections mode.
+	build := func(pieces []sectionPiece) (SchemaPart, []string, []Diagnostic) {
+		sections, keys := joinPieces(pieces)
+		fork := conv.fork()
+		part := SchemaPart{Schema: fork.keyedSchema(sections, keys), Sections: make([]string, 0, len(sections))}
+		for _, section := range sections {
+			part.Sections = append(part.Sections, section.Title)
+		}
+		trims := trimEnums(&part.Schema, report.Limits)
+		part.Stats = measureSchema(part.Schema)
+		return part, trims, fork.diagnostics
+	}
+	fits := func(pieces []sectionPiece) bool {
+		part, _, _ := build(pieces)
+		return len(report.Limits.exceeded(part.Stats)) == 0
+	}
+
+	keys := sectionKeys(f.Sections)
+	all := make([]sectionPiece, len(f.Sections))
+	for i, section := range f.Sections {
+		all[i] = sectionPiece{section: section, key: keys[i]}
+	}
+	whole, trims, diagnostics := build(all)
+	over := report.Limits.exceeded(whole.Stats)
+	if len(over) == 0 {
+		report.Actions = append(report.Actions, trims...)
+		return []SchemaPart{whole}, report, diagnostics, nil
+	}
+	report.Actions = append(report.Actions, fmt.Sprintf("schema exceeds limits (%s), split by section", strings.Join(over, ", ")))
+
+	var pieces []sectionPiece
+	for _, p := range all {
+		for _, section := range splitSection(p.section, func(s Section) bool {
+			return fits([]sectionPiece{{section: s, key: p.key}})
+		}) {
+			pieces = append(pieces, sectionPiece{section: section, key: p.key})
+		}
+	}
+	var groups [][]sectionPiece
+	var current []sectionPiece
+	for _, piece := range pieces {
+		candidate := append(append([]sectionPiece{}, current...), piece)
+		if len(current) == 0 || fits(candidate) {
+			current = candidate
+			continue
+		}
+		groups = append(groups, current)
+		current = []sectionPiece{piece}
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+
+	parts := make([]SchemaPart, 0, len(groups))
+	for i, group := range groups {
+		part, trims, _ := build(group)
+		for _, trim := range trims {
+			report.Actions = append(report.Actions, fmt.Sprintf("part %d: %s", i+1, trim))
+		}
+		if over := report.Limits.exceeded(part.Stats); len(over) > 0 {
+			report.Actions = append(report.Actions, fmt.Sprintf("part %d still exceeds limits (%s)", i+1, strings.Join(over, ", ")))
+		}
+		parts = append(parts, part)
+	}
+	return parts, report, diagnostics, nil
+}
+
+// sectionPiece is a section, or a part of one, with the key of the section
+// in the whole form.
+type sectionPiece struct {
+	section Section
+	key     string
+}
+
+// joinPieces puts the adjacent pieces of the same section back together.
+func joinPieces(pieces []sectionPiece) ([]Section, []string) {
+	sections := make([]Section, 0, len(pieces))
+	keys := make([]string, 0, len(pieces))
+	for _, p := range pieces {
+		if n := len(keys); n > 0 && keys[n-1] == p.key {
+			last := &sections[n-1]
+			last.Content = append(append([]Content(nil), last.Content...), p.section.Content...)
+			continue
+		}
+		sections = append(sections, p.section)
+		keys = append(keys, p.key)
+	}
+	return sections, keys
+}
+
+// splitSection halves the content of a section until every half fits. A
+// single field that does not fit is returned as a section of its own.
+func splitSection(section Section, fits func(Section) bool) []Section {
+	if len(section.Content) <= 1 || fits(section) {
+		return []Section{section}
+	}
+	half := len(section.Content) / 2
+	first := Section{Title: section.Title, Content: section.Content[:half]}
+	second := Section{Title: section.Title, Content: section.Content[half:]}
+	return append(splitSection(first, fits), splitSection(second, fits)...)
+}
+
+// trimEnums shortens the longest option lists of schema until the enum
+// values fit the limits. Every list is cut to the same limit, keeping the
+// options in form order.
+func trimEnums(schema *SchemaProperty, limits SchemaLimits) []string {
+	stats := measureSchema(*schema)
+	if stats.EnumValues <= limits.MaxEnumValues && stats.StringLength <= limits.MaxStringLength {
+		return nil
+	}
+	lengths := enumLengths(*schema, "")
+	limit := 0
+	for _, n := range lengths {
+		limit = maxInt(limit, n)
+	}
+	for limit > 1 {
+		trimmed := *schema
+		capEnums(&trimmed, limit, "", nil)
+		stats := measureSchema(trimmed)
+		if stats.EnumValues <= limits.MaxEnumValues && stats.StringLength <= limits.MaxStringLength {
+			break
+		}
+		limit = minInt(limit-1, limit*3/4)
+	}
+
+	capped := make(map[string]bool)
+	capEnums(schema, limit, "", capped)
+	paths := make([]string, 0, len(capped))
+	for path := range capped {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	actions := make([]string, 0, len(paths))
+	for _, path := range paths {
+		actions = append(actions, fmt.Sprintf("trimmed options of %s from %d to %d", path, lengths[path], limit))
+	}
+	return actions
+}
+
+func enumLengths(schema SchemaProperty, path string) map[string]int {
+	lengths := make(map[string]int)
+	if schema.Enum != nil {
+		lengths[path] = len(*schema.Enum)
+	}
+	for name, property := range schema.Properties {
+		for p, n := range enumLengths(property, pointer(path, name)) {
+			lengths[p] = n
+		}
+	}
+	if schema.Items != nil {
+		for p, n := range enumLengths(*schema.Items, path) {
+			lengths[p] = n
+		}
+	}
+	for i, branch := range schema.AnyOf {
+		for p, n := range enumLengths(branch, pointer(path, fmt.Sprintf("anyOf/%d", i))) {
+			lengths[p] = n
+		}
+	}
+	return lengths
+}
+
+// capEnums cuts every enum and oneOf of schema to limit entries. Map values
+// are copied, so the caller's schema is only changed through the pointer.
+func capEnums(schema *SchemaProperty, limit int, path string, capped map[string]bool) {
+	if schema.Enum != nil && len(*schema.Enum) > limit {
+		enum := append([]string{}, (*schema.Enum)[:limit]...)
+		schema.Enum = &enum
+		if capped != nil {
+			capped[path] = true
+		}
+	}
+	if schema.OneOf != nil && len(*schema.OneOf) > limit {
+		oneOf := append([]OneOf{}, (*schema.OneOf)[:limit]...)
+		schema.OneOf = &oneOf
+	}
+	if schema.Properties != nil {
+		properties := make(map[string]SchemaProperty, len(schema.Properties))
+		for name, property := range schema.Properties {
+			capEnums(&property, limit, pointer(path, name), capped)
+			properties[name] = property
+		}
+		schema.Properties = properties
+	}
+	if schema.Items != nil {
+		items := *schema.Items
+		capEnums(&items, limit, path, capped)
+		schema.Items = &items
+	}
+	if schema.AnyOf != nil {
+		anyOf := make([]SchemaProperty, 0, len(schema.AnyOf))
+		for i, branch := range schema.AnyOf {
+			capEnums(&branch, limit, pointer(path, fmt.Sprintf("anyOf/%d", i)), capped)
+			anyOf = append(anyOf, branch)
+		}
+		schema.AnyOf = anyOf
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func bigForm(sections, fields, options int) Form {
+	f := Form{}
+	for s := 0; s < sections; s++ {
+		section := Section{Title: fmt.Sprintf("s%d", s)}
+		for i := 0; i < fields; i++ {
+			item := Content{ID: fmt.Sprintf("s%d_f%d", s, i), Class: "edit", Title: "Field"}
+			if options > 0 {
+				item.Class = "select"
+				for o := 0; o < options; o++ {
+					item.Options = append(item.Options, Option{Title: "Option", Value: fmt.Sprintf("o%d", o)})
+				}
+			}
+			section.Content = append(section.Content, item)
+		}
+		f.Sections = append(f.Sections, section)
+	}
+	return f
+}
+
+func TestFitSchema_Fits(t *testing.T) {
+	parts, report, _, err := fitSchema(bigForm(2, 3, 0), SchemaOptions{})
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+	require.Equal(t, []string{"s0", "s1"}, parts[0].Sections)
+	require.Equal(t, SchemaStats{Properties: 6, Depth: 2, StringLength: 30}, parts[0].Stats)
+	require.Empty(t, report.Actions)
+	require.Equal(t, defaultSchemaLimits, report.Limits)
+}
+
+func TestFitSchema_TrimsOptions(t *testing.T) {
+	parts, report, _, err := fitSchema(bigForm(1, 2, 100), SchemaOptions{Limits: SchemaLimits{MaxEnumValues: 120}})
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+	require.LessOrEqual(t, parts[0].Stats.EnumValues, 120)
+	require.Equal(t, []string{
+		"trimmed options of /s0_f0 from 100 to 56",
+		"trimmed options of /s0_f1 from 100 to 56",
+	}, report.Actions)
+}
+
+func TestFitSchema_SplitsSections(t *testing.T) {
+	parts, report, _, err := fitSchema(bigForm(3, 4, 0), SchemaOptions{Limits: SchemaLimits{MaxProperties: 5}})
+	require.NoError(t, err)
+	require.Len(t, parts, 3)
+	for i, part := range parts {
+		require.Equal(t, []string{fmt.Sprintf("s%d", i)}, part.Sections)
+		require.Equal(t, 4, part.Stats.Properties)
+	}
+	require.Equal(t, []string{"schema exceeds limits (12 properties > 5), split by section"}, report.Actions)
+
+	parts, _, _, err = fitSchema(bigForm(1, 12, 0), SchemaOptions{Limits: SchemaLimits{MaxProperties: 5}})
+	require.NoError(t, err)
+	require.Len(t, parts, 4)
+	require.Equal(t, 3, parts[0].Stats.Properties)
+}
+
+func TestFitSchema_SplitsNestedSections(t *testing.T) {
+	f := bigForm(2, 6, 0)
+	f.Sections[1].Title = "s0"
+	opts := SchemaOptions{NestSections: true, Limits: SchemaLimits{MaxProperties: 5}}
+	parts, _, _, err := fitSchema(f, opts)
+	require.NoError(t, err)
+	require.Greater(t, len(parts), 2)
+
+	values := make(map[string]any)
+	for _, part := range parts {
+		answer := make(map[string]any)
+		for key, section := range part.Schema.Properties {
+			require.Contains(t, []string{"s0", "s0_section_2"}, key)
+			nested := make(map[string]any)
+			for id := range section.Properties {
+				nested[id] = id
+			}
+			answer[key] = nested
+		}
+		mergeValues(values, answer)
+	}
+	data, err := convertToFormData(f, values, opts)
+	require.NoError(t, err)
+	require.Len(t, data, 12)
+	require.Equal(t, "s1_f5", data["s1_f5"])
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Chunk is a part of the source text. Offset and End are the byte offsets of
+// Text in the original text, so results can cite where they come from.
+type Chunk struct {
+	Text   string `json:"-"`
+	Offset int    `json:"offset"`
+	End    int    `json:"end"`
+	Tokens int    `json:"tokens"`
+}
+
+const (
+	// maxChunkTokens caps the chunk budget of models with huge context
+	// windows: extraction quality drops long before the window is full.
+	maxChunkTokens = 8000
+	// promptReserveTokens is kept free for the response schema and framing.
+	promptReserveTokens = 1000
+	// tokenMarginPercent of the budget is left free because countTokens is
+	// an estimate and can count fewer tokens than the model's tokenizer.
+	tokenMarginPercent   = 15
+	defaultContextTokens = 8192
+	defaultOutputTokens  = 4096
+)
+
+// chunkBudget is the number of text tokens one request with params can take
+// next to the system message, the schema and the response, as counted by
+// countTokens. It fails when the response and the system message leave no
+// room for text.
+func chunkBudget(params GraphParams, systemMsg string) (int, error) {
+	limits := params.limits()
+	window, output := limits.context, limits.output
+	if params.MaxTokens != nil {
+		output = int(*params.MaxTokens)
+	}
+	budget := window - output - countTokens(systemMsg) - promptReserveTokens
+	budget = budget * (100 - tokenMarginPercent) / 100
+	if budget <= 0 {
+		return 0, fmt.Errorf("%d output tokens and the system message leave no room for text in the %d token context of %s", output, window, params.Model)
+	}
+	return minInt(budget, maxChunkTokens), nil
+}
+
+// tokenPieces splits text roughly the way BPE pre-tokenizers do.
+var tokenPieces = regexp.MustCompile(`\p{L}+|\p{N}{1,3}|[^\s\p{L}\p{N}]+|\s+`)
+
+// countTokens estimates the number of tokens of s. It is a heuristic, not the
+// model's BPE tokenizer: a word is one token per four letters, numbers are
+// split into groups of three digits, punctuation runs are one token and
+// whitespace only counts when it is more than a single space. The estimate
+// errs on the high side for English but can be low for code and rare scripts,
+// which is why chunkBudget keeps tokenMarginPercent free.
+func countTokens(s string) int {
+	tokens := 0
+	for _, piece := range tokenPieces.FindAllString(s, -1) {
+		r, _ := utf8.DecodeRuneInString(piece)
+		switch {
+		case piece == " ":
+		case strings.TrimSpace(piece) == "":
+			tokens++
+		case r < utf8.RuneSelf:
+			tokens += (len(piece) + 3) / 4
+		default:
+			// Non-Latin scripts take about a token per one or two runes.
+			tokens += (utf8.RuneCountInString(piece) + 1) / 2
+		}
+	}
+	return tokens
+}
+
+// segment is a sentence of the text, its trailing whitespace included.
+type segment struct {
+	start, end int
+	tokens     int
+	// paragraph is set on the last sentence of a paragraph.
+	paragraph bool
+}
+
+var (
+	paragraphBreak = regexp.MustCompile(`\n[ \t]*\n\s*`)
+	sentenceEnd    = regexp.MustCompile(`[.!?…]+["'»)\]]*\s+`)
+	wordEnd        = regexp.MustCompile(`\S+\s*`)
+)
+
+// segments splits text into sentences no longer than budget tokens. Longer
+// sentences are split between words, and words longer than budget by rune.
+func segments(text string, budget int) []segment {
+	var result []segment
+	add := func(start, end int, paragraph bool) {
+		s := text[start:end]
+		if tokens := countTokens(s); tokens <= budget {
+			result = append(result, segment{start: start, end: end, tokens: tokens, paragraph: paragraph})
+			return
+		}
+		var words []segment
+		for _, loc := range wordEnd.FindAllStringIndex(s, -1) {
+			words = append(words, splitWord(text, start+loc[0], start+loc[1], budget)...)
+		}
+		if len(words) > 0 {
+			words[len(words)-1].paragraph = paragraph
+		}
+		result = append(result, words...)
+	}
+
+	start := 0
+	for _, p := range append(paragraphBreak.FindAllStringIndex(text, -1), []int{len(text), len(text)}) {
+		paragraphEnd := p[1]
+		sentence := start
+		for _, loc := range sentenceEnd.FindAllStringIndex(text[start:p[0]], -1) {
+			add(sentence, start+loc[1], false)
+			sentence = start + loc[1]
+		}
+		if sentence < paragraphEnd {
+			add(sentence, paragraphEnd, true)
+		} else if len(result) > 0 {
+			result[len(result)-1].paragraph = true
+		}
+		start = paragraphEnd
+	}
+	return result
+}
+
+// splitWord cuts text[start:end] into pieces of at most budget tokens.
+func splitWord(text string, start, end, budget int) []segment {
+	var pieces []segment
+	for start < end {
+		cut := end
+		for countTokens(text[start:cut]) > budget {
+			// Halve the piece, keeping whole runes.
+			cut = start + (cut-start)/2
+			for cut > start+1 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+			if cut <= start+1 {
+				_, size := utf8.DecodeRuneInString(text[start:])
+				cut = start + size
+				break
+			}
+		}
+		pieces = append(pieces, segment{start: start, end: cut, tokens: countTokens(text[start:cut])})
+		start = cut
+	}
+	return pieces
+}
+
+// splitIntoChunks splits text into chunks of at most budget tokens on
+// paragraph and sentence boundaries. A chunk ends at the last paragraph end
+// in its second half if it has one. Each chunk after the first repeats the
+// sentences that make up the last overlap tokens of the chunk before it.
+func splitIntoChunks(text string, budget, overlap int) []Chunk {
+	if budget <= 0 {
+		budget = 1
+	}
+	if overlap >= budget {
+		overlap = budget / 2
+	}
+	segs := segments(text, budget)
+	if len(segs) == 0 {
+		return []Chunk{{Text: text, Offset: 0, End: len(text)}}
+	}
+
+	var chunks []Chunk
+	for first := 0; first < len(segs); {
+		last, tokens := first, segs[first].tokens
+		for last+1 < len(segs) && tokens+segs[last+1].tokens <= budget {
+			last++
+			tokens += segs[last].tokens
+		}
+		if last+1 < len(segs) {
+			for i, sum := last, tokens; i > first && sum >= budget/2; i-- {
+				if segs[i].paragraph {
+					last = i
+					break
+				}
+				sum -= segs[i].tokens
+			}
+		}
+		start, end := segs[first].start, segs[last].end
+		chunks = append(chunks, Chunk{Text: text[start:end], Offset: start, End: end, Tokens: sumTokens(segs[first : last+1])})
+		if last+1 == len(segs) {
+			break
+		}
+
+		next := last + 1
+		for carried := 0; next-1 > first && carried+segs[next-1].tokens <= overlap; {
+			next--
+			carried += segs[next].tokens
+		}
+		first = next
+	}
+	return chunks
+}
+
+func sumTokens(segs []segment) int {
+	tokens := 0
+	for _, s := range segs {
+		tokens += s.tokens
+	}
+	return tokens
+}
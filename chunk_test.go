@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountTokens(t *testing.T) {
+	require.Equal(t, 0, countTokens(""))
+	require.Equal(t, 6, countTokens("Hello, world."))
+	require.Equal(t, 3, countTokens("1234567"))
+	require.Equal(t, 4, countTokens("extraordinary"))
+	require.Equal(t, 3, countTokens("Привет"))
+}
+
+func TestChunkBudget(t *testing.T) {
+	budget := func(params GraphParams, systemMsg string) int {
+		n, err := chunkBudget(params, systemMsg)
+		require.NoError(t, err)
+		return n
+	}
+	require.Equal(t, maxChunkTokens, budget(GraphParams{Model: graphModel}, "system"))
+	require.Equal(t, maxChunkTokens, budget(GraphParams{Model: "gpt-4o-2024-11-20"}, "system"))
+	require.Equal(t, (8192-4096-1000-2)*85/100, budget(GraphParams{Model: "llama3"}, "system"))
+	maxTokens := int64(2000)
+	require.Equal(t, (8192-2000-1000-2)*85/100, budget(GraphParams{Model: "llama3", MaxTokens: &maxTokens}, "system"))
+
+	_, err := chunkBudget(GraphParams{Model: "unknown"}, strings.Repeat("word ", 10000))
+	require.EqualError(t, err, "4096 output tokens and the system message leave no room for text in the 8192 token context of unknown")
+	maxTokens = 8000
+	_, err = chunkBudget(GraphParams{Model: "llama3", MaxTokens: &maxTokens}, "system")
+	require.Error(t, err)
+}
+
+func TestSplitIntoChunks(t *testing.T) {
+	text := "One two three. Four five six.\n\nSeven eight nine. Ten eleven twelve! Thirteen fourteen?\n\nFifteen."
+
+	t.Run("fits", func(t *testing.T) {
+		chunks := splitIntoChunks(text, 1000, 0)
+		require.Len(t, chunks, 1)
+		require.Equal(t, Chunk{Text: text, Offset: 0, End: len(text), Tokens: countTokens(text)}, chunks[0])
+	})
+
+	t.Run("boundaries", func(t *testing.T) {
+		chunks := splitIntoChunks(text, 12, 0)
+		var texts []string
+		for _, c := range chunks {
+			require.Equal(t, text[c.Offset:c.End], c.Text)
+			require.LessOrEqual(t, c.Tokens, 12)
+			texts = append(texts, c.Text)
+		}
+		require.Equal(t, []string{
+			"One two three. Four five six.\n\n",
+			"Seven eight nine. Ten eleven twelve! ",
+			"Thirteen fourteen?\n\nFifteen.",
+		}, texts)
+		require.Equal(t, text, strings.Join(texts, ""))
+	})
+
+	t.Run("overlap", func(t *testing.T) {
+		chunks := splitIntoChunks(text, 12, 6)
+		require.Equal(t, "Four five six.\n\nSeven eight nine. ", chunks[1].Text)
+		require.Less(t, chunks[1].Offset, chunks[0].End)
+		require.True(t, strings.HasSuffix(chunks[len(chunks)-1].Text, "Fifteen."))
+	})
+
+	t.Run("long sentence", func(t *testing.T) {
+		long := strings.Repeat("word ", 30) + "end."
+		chunks := splitIntoChunks(long, 10, 0)
+		require.Greater(t, len(chunks), 1)
+		var joined strings.Builder
+		for _, c := range chunks {
+			require.LessOrEqual(t, c.Tokens, 10)
+			joined.WriteString(c.Text)
+		}
+		require.Equal(t, long, joined.String())
+	})
+
+	t.Run("long word", func(t *testing.T) {
+		word := strings.Repeat("ж", 50)
+		chunks := splitIntoChunks(word, 5, 0)
+		var joined strings.Builder
+		for _, c := range chunks {
+			require.LessOrEqual(t, c.Tokens, 5)
+			joined.WriteString(c.Text)
+		}
+		require.Equal(t, word, joined.String())
+	})
+}
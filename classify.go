@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"graph_maker/aihands"
+	"strconv"
+	"strings"
+)
+
+const defaultClassifySystemMsg = "You sort texts into forms. Choose the one form the text is about, " +
+	"set formId to its ID and fill it in. Only use facts stated in the text. " +
+	"For every field you fill, add an evidence entry with your confidence from 0 to 1 and the exact quote of the text it comes from."
+
+// ClassifyResult is the form chosen for a text together with its filled data.
+type ClassifyResult struct {
+	FormID    int                    `json:"form_id"`
+	FormTitle string                 `json:"form_title"`
+	Values    map[string]any         `json:"values"`
+	Data      map[string]any         `json:"data"`
+	Fields    map[string]FilledField `json:"fields"`
+}
+
+// classifySchema is a union of the fill schemas of forms. Every branch has a
+// formId holding the form ID as its only allowed value, so the branch the
+// model answers with tells which form it chose.
+func classifySchema(forms []Form, opts SchemaOptions) (SchemaProperty, error) {
+	branches := make([]SchemaProperty, 0, len(forms))
+	for i, f := range forms {
+		if f.ID == 0 {
+			return SchemaProperty{}, fmt.Errorf("form %d has no id", i)
+		}
+		parts, _, _, err := fitSchema(f, opts)
+		if err != nil {
+			return SchemaProperty{}, fmt.Errorf("form %d: %w", f.ID, err)
+		}
+		if len(parts) > 1 {
+			return SchemaProperty{}, fmt.Errorf("form %d needs %d schemas to fit the limits, classification supports one", f.ID, len(parts))
+		}
+
+		id := []string{strconv.Itoa(f.ID)}
+		branch := fillSchema(parts[0].Schema, opts.NestSections)
+		branch.Description = f.Title
+		if f.Description != "" {
+			branch.Description += ": " + f.Description
+		}
+		branch.Properties["formId"] = SchemaProperty{Type: "string", Description: "ID of the chosen form", Enum: &id}
+		branch.Required = append([]string{"formId"}, branch.Required...)
+		branches = append(branches, branch)
+	}
+	if len(branches) == 0 {
+		return SchemaProperty{}, fmt.Errorf("no forms")
+	}
+
+	// Strict mode wants an object at the root, so the union is one level down.
+	schema := objectSchema()
+	schema.Properties["form"] = SchemaProperty{Description: "The form the text is about", AnyOf: branches}
+	schema.Required = []string{"form"}
+	if over := opts.Limits.withDefaults().exceeded(measureSchema(schema)); len(over) > 0 {
+		return schema, fmt.Errorf("classification schema exceeds limits (%s), pass fewer forms", strings.Join(over, ", "))
+	}
+	return schema, nil
+}
+
+// classifyForm lets the model choose which of forms the text belongs to and
+// fill that form in the same call.
+func classifyForm(ctx context.Context, forms []Form, text string, opts SchemaOptions, settings FillSettings) (ClassifyResult, error) {
+	schema, err := classifySchema(forms, opts)
+	if err != nil {
+		return ClassifyResult{}, err
+	}
+	return classifyText(ctx, schema, forms, text, opts, settings)
+}
+
+// classifyText is classifyForm with the classifySchema of forms already built.
+func classifyText(ctx context.Context, schema SchemaProperty, forms []Form, text string, opts SchemaOptions, settings FillSettings) (ClassifyResult, error) {
+	var result ClassifyResult
+	if settings.SystemMsg == "" {
+		settings.SystemMsg = defaultClassifySystemMsg
+	}
+	var answer struct {
+		Form struct {
+			FormID   string          `json:"formId"`
+			Values   map[string]any  `json:"values"`
+			Evidence []FieldEvidence `json:"evidence"`
+		} `json:"form"`
+	}
+	if err := askFill(ctx, 1, schema, text, opts, settings.withDefaults(), &answer); err != nil {
+		return result, err
+	}
+
+	for _, f := range forms {
+		if strconv.Itoa(f.ID) != answer.Form.FormID {
+			continue
+		}
+		data, err := convertToFormData(f, answer.Form.Values, opts)
+		if err != nil {
+			return result, fmt.Errorf("form %d: %w", f.ID, err)
+		}
+		return ClassifyResult{
+			FormID:    f.ID,
+			FormTitle: f.Title,
+			Values:    answer.Form.Values,
+			Data:      data,
+			Fields:    filledFields(data, answer.Form.Evidence),
+		}, nil
+	}
+	return result, fmt.Errorf("model chose unknown form %q", answer.Form.FormID)
+}
+
+// usercodeClassifyForm handles classify_form_req: the model picks the form
+// of the text out of forms and fills it.
+func usercodeClassifyForm(ctx context.Context, data1 map[string]any, cf map[string]any) error {
+	list, ok := cf["forms"].([]any)
+	if !ok || len(list) == 0 {
+		return fmt.Errorf("no classify_form_req.forms")
+	}
+	forms := make([]Form, 0, len(list))
+	for i, item := range list {
+		f, err := parseForm(item)
+		if err != nil {
+			return fmt.Errorf("classify_form_req.forms[%d]: %w", i, err)
+		}
+		forms = append(forms, f)
+	}
+	text, _ := cf["text"].(string)
+	if text == "" {
+		return fmt.Errorf("no classify_form_req.text")
+	}
+	key, _ := cf["open_api_key"].(string)
+	if key == "" {
+		return fmt.Errorf("no classify_form_req.open_api_key")
+	}
+	if simKey, ok := cf["sim_api_key"].(string); ok {
+		aihands.Token = simKey
+	}
+
+	opts, err := schemaOptions(cf)
+	if err != nil {
+		return fmt.Errorf("classify_form_req: %w", err)
+	}
+	result, err := classifyForm(ctx, forms, text, opts, fillSettings(cf))
+	if err != nil {
+		data1["classify_form_rsp"] = map[string]any{
+			"status": "error",
+			"error":  err.Error(),
+		}
+		return fmt.Errorf("classify form: %w", err)
+	}
+	data1["classify_form_rsp"] = map[string]any{
+		"form_id":    result.FormID,
+		"form_title": result.FormTitle,
+		"values":     result.Values,
+		"data":       result.Data,
+		"fields":     result.Fields,
+		"status":     "ok",
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func classifyForms() []Form {
+	task := dataForm()
+	task.ID = 11
+	person := Form{ID: 12, Title: "Person", Sections: []Section{{
+		Title:   "main",
+		Content: []Content{{ID: "full_name", Class: "edit", Title: "Full name", Required: true}},
+	}}}
+	return []Form{task, person}
+}
+
+func TestClassifySchema(t *testing.T) {
+	schema, err := classifySchema(classifyForms(), SchemaOptions{Strict: true})
+	require.NoError(t, err)
+	branches := schema.Properties["form"].AnyOf
+	require.Len(t, branches, 2)
+	require.Equal(t, []string{"12"}, *branches[1].Properties["formId"].Enum)
+	require.Equal(t, []string{"formId", "values", "evidence"}, branches[1].Required)
+
+	require.Empty(t, validateSchema(schema, map[string]any{"form": map[string]any{
+		"formId": "12", "values": map[string]any{"full_name": "Ann"}, "evidence": []any{},
+	}}))
+	require.NotEmpty(t, validateSchema(schema, map[string]any{"form": map[string]any{
+		"formId": "13", "values": map[string]any{"full_name": "Ann"}, "evidence": []any{},
+	}}))
+
+	_, err = classifySchema([]Form{dataForm()}, SchemaOptions{})
+	require.EqualError(t, err, "form 0 has no id")
+}
+
+func TestClassifyForm(t *testing.T) {
+	fakeChat(t, `{"form": {"formId": "12", "values": {"full_name": "Ann Lee"},
+		"evidence": [{"field": "full_name", "confidence": 0.8, "quote": "Ann Lee"}]}}`)
+	result, err := classifyForm(context.Background(), classifyForms(), "Ann Lee joined today.", SchemaOptions{Strict: true}, FillSettings{})
+	require.NoError(t, err)
+	require.Equal(t, 12, result.FormID)
+	require.Equal(t, map[string]any{"full_name": "Ann Lee"}, result.Data)
+	require.Equal(t, 0.8, result.Fields["full_name"].Confidence)
+}
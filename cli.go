@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// runCLI runs the command line subcommands of graph_maker and returns the
+// exit code:
+//
+//	graph_maker gen [-lang go|ts] [-package forms] [-name Task] [-form-id 12] [-o out.go] form.json
+func runCLI(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "gen" {
+		fmt.Fprintln(stderr, "usage: graph_maker gen [flags] form.json")
+		return 2
+	}
+	fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	lang := fs.String("lang", "go", "output language: go or ts")
+	pkg := fs.String("package", "forms", "Go package name")
+	name := fs.String("name", "", "type name, the form title by default")
+	formID := fs.Int("form-id", 0, "platform form ID, overrides the id of the form file")
+	out := fs.String("o", "", "output file, stdout by default")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "usage: graph_maker gen [flags] form.json")
+		return 2
+	}
+
+	code, err := genFile(fs.Arg(0), *lang, *pkg, *name, *formID)
+	if err != nil {
+		fmt.Fprintf(stderr, "gen: %v\n", err)
+		return 1
+	}
+	if *out == "" {
+		_, err = stdout.Write(code)
+	} else {
+		err = os.WriteFile(*out, code, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "gen: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// genFile generates the types of the form in the JSON file at path. The file
+// holds either a form or a gitcall request with the form under "forms".
+func genFile(path, lang, pkg, name string, formID int) ([]byte, error) {
+	bin, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var v map[string]any
+	if err := json.Unmarshal(bin, &v); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if forms, ok := v["forms"].(map[string]any); ok {
+		v = forms
+	}
+	f, err := parseForm(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if formID != 0 {
+		f.ID = formID
+	}
+	switch lang {
+	case "go":
+		return generateGo(f, pkg, name)
+	case "ts":
+		return generateTS(f, name)
+	}
+	return nil, fmt.Errorf("unknown language %s", lang)
+}
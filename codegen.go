@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const generatedHeader = "// Code generated by graph_maker gen; DO NOT EDIT.\n"
+
+// genKind is the type of a generated field.
+type genKind struct {
+	// Base is string, integer, number, boolean, option, calendar, object or any.
+	Base string
+	List bool
+	// Object is the generated type name of an object.
+	Object string
+}
+
+type genField struct {
+	ID       string
+	Name     string
+	Doc      string
+	Kind     genKind
+	Required bool
+}
+
+type genType struct {
+	Name   string
+	Doc    string
+	Fields []genField
+}
+
+// genModel is the language independent description of the generated code.
+type genModel struct {
+	Name   string
+	FormID int
+	Types  []genType
+	// Options and Calendar tell whether the shared platform types are used.
+	Options  bool
+	Calendar bool
+}
+
+// buildGenModel describes the actor data of f. Field types come from the
+// convertToJSONSchema class mapping, except for select-like and calendar
+// fields whose form data has a platform shape of its own.
+func buildGenModel(f Form, name string) (*genModel, error) {
+	if name == "" {
+		name = goName(f.Title, "Form")
+	}
+	// Actor data holds every field, whatever the model is allowed to see.
+	f.Sections = append([]Section(nil), f.Sections...)
+	for i := range f.Sections {
+		content := make([]Content, len(f.Sections[i].Content))
+		for j, item := range f.Sections[i].Content {
+			item.Visibility, item.Value, item.IDNotChanged = "", nil, false
+			content[j] = item
+		}
+		f.Sections[i].Content = content
+	}
+	conv := newConversion(SchemaOptions{})
+	m := &genModel{Name: name, FormID: f.ID}
+	root := genType{Name: name, Doc: "the actor data of the form"}
+	if f.Title != "" {
+		root.Doc = fmt.Sprintf("the actor data of the %q form", f.Title)
+	}
+	names := make(map[string]bool)
+	for _, section := range f.Sections {
+		for _, item := range section.Content {
+			field, err := m.field(conv, section.Title, item, name, names)
+			if err != nil {
+				return nil, err
+			}
+			root.Fields = append(root.Fields, field)
+		}
+	}
+	m.Types = append([]genType{root}, m.Types...)
+	return m, nil
+}
+
+func (m *genModel) field(conv *conversion, section string, item Content, parent string, names map[string]bool) (genField, error) {
+	field := genField{ID: item.ID, Name: uniqueName(goName(item.ID, "Field"), names), Required: item.Required}
+	converter, ok := fieldConverters[item.Class]
+	if !ok {
+		field.Kind = genKind{Base: "any"}
+		return field, nil
+	}
+	f := conv.field(section, item)
+	field.Doc = f.Description()
+	switch c := converter.(type) {
+	case selectConverter:
+		m.Options = true
+		field.Kind = genKind{Base: "option", List: true}
+		return field, nil
+	case calendarConverter:
+		m.Calendar = true
+		field.Kind = genKind{Base: "calendar"}
+		return field, nil
+	case tableConverter:
+		row := genType{Name: parent + field.Name + "Row", Doc: fmt.Sprintf("a row of the %q table", item.Title)}
+		rowNames := make(map[string]bool)
+		if item.Extra != nil {
+			for _, column := range item.Extra.Columns {
+				cell, err := m.field(conv, section, column, row.Name, rowNames)
+				if err != nil {
+					return field, err
+				}
+				row.Fields = append(row.Fields, cell)
+			}
+		}
+		m.Types = append(m.Types, row)
+		field.Kind = genKind{Base: "object", List: true, Object: row.Name}
+		return field, nil
+	default:
+		schema, ok, err := c.Schema(f)
+		if err != nil {
+			return field, fmt.Errorf("field %s: %w", item.ID, err)
+		}
+		if !ok {
+			field.Kind = genKind{Base: "any"}
+			return field, nil
+		}
+		field.Kind = schemaKind(schema)
+		if schema.Description != "" {
+			field.Doc = schema.Description
+		}
+	}
+	return field, nil
+}
+
+func schemaKind(schema SchemaProperty) genKind {
+	if schema.Type == "array" && schema.Items != nil {
+		kind := schemaKind(*schema.Items)
+		if kind.List {
+			return genKind{Base: "any"}
+		}
+		kind.List = true
+		return kind
+	}
+	switch schema.Type {
+	case "string", "integer", "number", "boolean":
+		return genKind{Base: schema.Type}
+	}
+	return genKind{Base: "any"}
+}
+
+var nonAlnum = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// goName turns a form title or field ID into an exported Go identifier.
+func goName(s, fallback string) string {
+	var b strings.Builder
+	for _, word := range nonAlnum.Split(s, -1) {
+		runes := []rune(word)
+		if len(runes) == 0 {
+			continue
+		}
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	name := b.String()
+	if name == "" {
+		return fallback
+	}
+	if first := []rune(name)[0]; !unicode.IsLetter(first) || !unicode.IsUpper(first) {
+		name = fallback + name
+	}
+	return name
+}
+
+func uniqueName(name string, names map[string]bool) string {
+	unique := name
+	for i := 2; names[unique]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	names[unique] = true
+	return unique
+}
+
+// generateGo emits Go structs for the actor data of f.
+func generateGo(f Form, pkg, name string) ([]byte, error) {
+	m, err := buildGenModel(f, name)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	b.WriteString(generatedHeader + "\n")
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+
+	b.WriteString("const (\n")
+	if m.FormID != 0 {
+		fmt.Fprintf(&b, "%sFormID = %d\n", m.Name, m.FormID)
+	}
+	for _, field := range m.Types[0].Fields {
+		fmt.Fprintf(&b, "%sField%s = %q\n", m.Name, field.Name, field.ID)
+	}
+	b.WriteString(")\n\n")
+
+	if m.Options {
+		b.WriteString("// FormOption is a chosen option of a select, multiSelect, radio or link field.\n")
+		b.WriteString("type FormOption struct {\nValue string `json:\"value\"`\nTitle string `json:\"title\"`\n}\n\n")
+	}
+	if m.Calendar {
+		b.WriteString("// Calendar is the value of a calendar field, dates in unixtime seconds.\n")
+		b.WriteString("type Calendar struct {\nStartDate int64 `json:\"startDate\"`\nEndDate int64 `json:\"endDate\"`\n" +
+			"TimeZoneOffset int64 `json:\"timeZoneOffset\"`\nSendInvite bool `json:\"sendInvite\"`\n}\n\n")
+	}
+	for _, t := range m.Types {
+		fmt.Fprintf(&b, "// %s is %s.\n", t.Name, t.Doc)
+		fmt.Fprintf(&b, "type %s struct {\n", t.Name)
+		for _, field := range t.Fields {
+			if field.Doc != "" {
+				fmt.Fprintf(&b, "// %s\n", field.Doc)
+			}
+			tag := field.ID
+			if !field.Required {
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(&b, "%s %s `json:%q`\n", field.Name, goType(field.Kind, field.Required), tag)
+		}
+		b.WriteString("}\n\n")
+	}
+	return format.Source([]byte(b.String()))
+}
+
+func goType(kind genKind, required bool) string {
+	var t string
+	switch kind.Base {
+	case "string":
+		t = "string"
+	case "integer":
+		t = "int64"
+	case "number":
+		t = "float64"
+	case "boolean":
+		t = "bool"
+	case "option":
+		t = "FormOption"
+	case "calendar":
+		t = "Calendar"
+	case "object":
+		t = kind.Object
+	default:
+		return "any"
+	}
+	if kind.List {
+		return "[]" + t
+	}
+	if !required {
+		return "*" + t
+	}
+	return t
+}
+
+var tsIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// generateTS emits TypeScript interfaces for the actor data of f.
+func generateTS(f Form, name string) ([]byte, error) {
+	m, err := buildGenModel(f, name)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	b.WriteString(generatedHeader + "\n")
+	if m.FormID != 0 {
+		fmt.Fprintf(&b, "export const %sFormID = %d;\n\n", m.Name, m.FormID)
+	}
+	fmt.Fprintf(&b, "export const %sFields = {\n", m.Name)
+	for _, field := range m.Types[0].Fields {
+		fmt.Fprintf(&b, "  %s: %q,\n", field.Name, field.ID)
+	}
+	b.WriteString("} as const;\n\n")
+
+	if m.Options {
+		b.WriteString("/** A chosen option of a select, multiSelect, radio or link field. */\n")
+		b.WriteString("export interface FormOption {\n  value: string;\n  title: string;\n}\n\n")
+	}
+	if m.Calendar {
+		b.WriteString("/** The value of a calendar field, dates in unixtime seconds. */\n")
+		b.WriteString("export interface Calendar {\n  startDate: number;\n  endDate: number;\n  timeZoneOffset: number;\n  sendInvite: boolean;\n}\n\n")
+	}
+	for i, t := range m.Types {
+		fmt.Fprintf(&b, "/** %s is %s. */\nexport interface %s {\n", t.Name, t.Doc, t.Name)
+		for _, field := range t.Fields {
+			if field.Doc != "" {
+				fmt.Fprintf(&b, "  /** %s */\n", field.Doc)
+			}
+			key := field.ID
+			if !tsIdentifier.MatchString(key) {
+				key = strconv.Quote(key)
+			}
+			optional := ""
+			if !field.Required {
+				optional = "?"
+			}
+			fmt.Fprintf(&b, "  %s%s: %s;\n", key, optional, tsType(field.Kind))
+		}
+		b.WriteString("}\n")
+		if i < len(m.Types)-1 {
+			b.WriteString("\n")
+		}
+	}
+	return []byte(b.String()), nil
+}
+
+func tsType(kind genKind) string {
+	var t string
+	switch kind.Base {
+	case "string":
+		t = "string"
+	case "integer", "number":
+		t = "number"
+	case "boolean":
+		t = "boolean"
+	case "option":
+		t = "FormOption"
+	case "calendar":
+		t = "Calendar"
+	case "object":
+		t = kind.Object
+	default:
+		return "unknown"
+	}
+	if kind.List {
+		return t + "[]"
+	}
+	return t
+}
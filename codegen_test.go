@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateGo(t *testing.T) {
+	f := dataForm()
+	f.ID = 11
+	code, err := generateGo(f, "forms", "")
+	require.NoError(t, err)
+	require.Contains(t, string(code), "TaskFormID     = 11\n")
+	require.Contains(t, string(code), "\tName string `json:\"name\"`\n")
+	require.Contains(t, string(code), "\tDone *bool `json:\"done,omitempty\"`\n")
+	require.Contains(t, string(code), "\tColor []FormOption `json:\"color,omitempty\"`\n")
+	require.Contains(t, string(code), "\tDue *Calendar `json:\"due,omitempty\"`\n")
+
+	code, err = generateGo(classesForm(), "forms", "Deal")
+	require.NoError(t, err)
+	require.Contains(t, string(code), "type DealItemsRow struct {")
+	require.Contains(t, string(code), "Items []DealItemsRow `json:\"items\"`")
+}
+
+func TestGenerateTS(t *testing.T) {
+	code, err := generateTS(dataForm(), "")
+	require.NoError(t, err)
+	require.Contains(t, string(code), "export interface Task {\n")
+	require.Contains(t, string(code), "  name: string;\n")
+	require.Contains(t, string(code), "  color?: FormOption[];\n")
+	require.NotContains(t, string(code), "TaskFormID")
+}
+
+func TestRunCLI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "form.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"title": "Task", "sections": [
+		{"title": "main", "content": [{"id": "name", "class": "edit", "title": "Name"}]}
+	]}`), 0o644))
+
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, runCLI([]string{"gen", "-lang", "ts", "-form-id", "7", path}, &stdout, &stderr))
+	require.Contains(t, stdout.String(), "export const TaskFormID = 7;")
+
+	stdout.Reset()
+	require.Equal(t, 1, runCLI([]string{"gen", "-lang", "rust", path}, &stdout, &stderr))
+	require.Contains(t, stderr.String(), "gen: unknown language rust")
+}
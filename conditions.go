@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Ways to put field conditions into a schema. Both describe the condition
+// in the field description; ConditionsIfThenElse also adds if/then/else
+// clauses, which OpenAI strict mode and Gemini do not accept.
+const (
+	ConditionsDescribe   = "describe"
+	ConditionsIfThenElse = "if_then_else"
+)
+
+// fieldLocation is where a field ends up in the schema: section is its
+// section key in NestSections mode, title the section title. outside is set
+// on the fields of the form while the columns of a table row are converted.
+type fieldLocation struct {
+	item    Content
+	section string
+	title   string
+	outside bool
+}
+
+// conditionalField is a field with conditions added to the schema.
+type conditionalField struct {
+	item   Content
+	schema SchemaProperty
+}
+
+// index records the fields of sections before they are converted.
+func (c *conversion) index(sections []Section, keys []string) {
+	c.fields = make(map[string]fieldLocation)
+	c.conditional = nil
+	for i, section := range sections {
+		key := ""
+		if c.opts.NestSections {
+			key = keys[i]
+		}
+		for _, item := range section.Content {
+			c.fields[item.ID] = fieldLocation{item: item, section: key, title: section.Title}
+		}
+	}
+}
+
+// rowSchema converts the columns of a table in section into the schema of
+// one row. Conditions between columns become if/then/else clauses of the row,
+// conditions on fields outside the table are only described.
+func (c *conversion) rowSchema(section string, columns []Content) SchemaProperty {
+	fields, conditional := c.fields, c.conditional
+	defer func() { c.fields, c.conditional = fields, conditional }()
+
+	c.fields = make(map[string]fieldLocation, len(fields)+len(columns))
+	for id, location := range fields {
+		location.outside = true
+		c.fields[id] = location
+	}
+	for _, column := range columns {
+		c.fields[column.ID] = fieldLocation{item: column, title: section}
+	}
+	c.conditional = nil
+
+	row := objectSchema()
+	for _, column := range columns {
+		c.addField(&row, section, column)
+	}
+	c.addConditions(&row)
+	return row
+}
+
+// describeConditions tells the model when a field applies.
+func (c *conversion) describeConditions(conditions []Condition) string {
+	parts := make([]string, 0, len(conditions))
+	for _, condition := range conditions {
+		title := condition.Field
+		if location, ok := c.fields[condition.Field]; ok && location.item.Title != "" {
+			title = location.item.Title
+		}
+		values := make([]string, 0, len(condition.Values))
+		for _, v := range condition.Values {
+			values = append(values, strconv.Quote(v))
+		}
+		parts = append(parts, fmt.Sprintf("%q is %s", title, strings.Join(values, " or ")))
+	}
+	return "only applies when " + strings.Join(parts, " and ") + ", otherwise null"
+}
+
+// addConditions adds one if/then/else clause per conditional field to root in
+// ConditionsIfThenElse mode. Conditions on fields that are not part of the
+// schema stay in the description only.
+func (c *conversion) addConditions(root *SchemaProperty) {
+	if c.opts.Conditions != ConditionsIfThenElse {
+		return
+	}
+	for _, conditional := range c.conditional {
+		item := conditional.item
+		field := c.field(c.fields[item.ID].title, item)
+		clause := SchemaProperty{}
+		ok := true
+		for _, condition := range item.Conditions {
+			location, found := c.fields[condition.Field]
+			controller, inSchema := c.property(root, condition.Field)
+			if !found || location.outside || !inSchema {
+				field.Warn("condition on %s is not in the schema, only described", condition.Field)
+				ok = false
+				break
+			}
+			setClause(&clause, location.section, condition.Field, conditionSchema(controller, condition.Values), true)
+		}
+		if !ok {
+			continue
+		}
+		section := c.fields[item.ID].section
+		then := SchemaProperty{}
+		if item.Required {
+			setClause(&then, section, item.ID, SchemaProperty{Type: conditional.schema.Type}, true)
+		}
+		otherwise := SchemaProperty{}
+		setClause(&otherwise, section, item.ID, SchemaProperty{Type: "null"}, false)
+		root.AllOf = append(root.AllOf, SchemaProperty{If: &clause, Then: &then, Else: &otherwise})
+	}
+}
+
+// property finds the schema of a field in root.
+func (c *conversion) property(root *SchemaProperty, id string) (SchemaProperty, bool) {
+	obj := *root
+	if section := c.fields[id].section; section != "" {
+		obj = root.Properties[section]
+	}
+	property, ok := obj.Properties[id]
+	return property, ok
+}
+
+// conditionSchema matches a controlling field having one of values.
+func conditionSchema(controller SchemaProperty, values []string) SchemaProperty {
+	switch controller.Type {
+	case "array":
+		enum := append([]string{}, values...)
+		return SchemaProperty{Contains: &SchemaProperty{Enum: &enum}}
+	case "boolean":
+		var anyOf []SchemaProperty
+		for _, v := range values {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				continue
+			}
+			value := any(b)
+			anyOf = append(anyOf, SchemaProperty{Const: &value})
+		}
+		if len(anyOf) == 1 {
+			return anyOf[0]
+		}
+		return SchemaProperty{AnyOf: anyOf}
+	}
+	enum := append([]string{}, values...)
+	return SchemaProperty{Enum: &enum}
+}
+
+// setClause puts property at id, inside the section object in NestSections mode.
+func setClause(clause *SchemaProperty, section, id string, property SchemaProperty, required bool) {
+	if section != "" {
+		nested := clause.Properties[section]
+		setClause(&nested, "", id, property, required)
+		property, id = nested, section
+	}
+	if clause.Properties == nil {
+		clause.Properties = make(map[string]SchemaProperty)
+	}
+	clause.Properties[id] = property
+	if required && !contains(clause.Required, id) {
+		clause.Required = append(clause.Required, id)
+	}
+}
+
+// nullUnmet sets the fields of the else clauses whose condition does not
+// hold to null, so fields that do not apply are never filled.
+func nullUnmet(schema SchemaProperty, value map[string]any) {
+	for _, clause := range schema.AllOf {
+		if clause.If == nil || clause.Else == nil || len(validateSchema(*clause.If, value)) == 0 {
+			continue
+		}
+		nullFields(*clause.Else, value)
+	}
+}
+
+func nullFields(clause SchemaProperty, value map[string]any) {
+	for key, property := range clause.Properties {
+		if property.Type == "null" {
+			if _, ok := value[key]; ok {
+				value[key] = nil
+			}
+			continue
+		}
+		if nested, ok := value[key].(map[string]any); ok {
+			nullFields(property, nested)
+		}
+	}
+}
+
+// conditionsMet reports whether all conditions hold for the form data.
+func conditionsMet(conditions []Condition, data map[string]any) bool {
+	for _, condition := range conditions {
+		met := false
+		for _, v := range formDataStrings(data[condition.Field]) {
+			if contains(condition.Values, v) {
+				met = true
+				break
+			}
+		}
+		if !met {
+			return false
+		}
+	}
+	return true
+}
+
+// formDataStrings lists the values of a form data value as strings: the
+// option values of select-like fields, the value itself otherwise.
+func formDataStrings(value any) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []map[string]any:
+		values := make([]string, 0, len(v))
+		for _, option := range v {
+			values = append(values, fmt.Sprint(option["value"]))
+		}
+		return values
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if option, ok := item.(map[string]any); ok {
+				item = option["value"]
+			}
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	}
+	return []string{fmt.Sprint(value)}
+}
+
+// applyConditions drops the form data of fields whose conditions do not hold
+// and reports the required ones that are missing while they apply.
+func (c *conversion) applyConditions(f Form, data map[string]any) []error {
+	var errs []error
+	for _, section := range f.Sections {
+		errs = append(errs, c.applyItemConditions(section.Title, section.Content, data, "")...)
+	}
+	return errs
+}
+
+// applyItemConditions is applyConditions for the items of one object, a
+// section or a table row. Errors are prefixed with path.
+func (c *conversion) applyItemConditions(section string, items []Content, data map[string]any, path string) []error {
+	var errs []error
+	for _, item := range items {
+		if len(item.Conditions) == 0 {
+			continue
+		}
+		if !conditionsMet(item.Conditions, data) {
+			delete(data, item.ID)
+			continue
+		}
+		if _, ok := data[item.ID]; ok || !item.Required || item.hidden() {
+			continue
+		}
+		converter, ok := fieldConverters[item.Class]
+		if !ok {
+			continue
+		}
+		if _, ok, err := converter.Schema(c.field(section, item)); err == nil && ok {
+			errs = append(errs, fmt.Errorf("%s%s: required field is missing", path, item.ID))
+		}
+	}
+	return errs
+}
+
+// rowConditional lists the columns whose conditions only depend on other
+// columns, the ones applyItemConditions can check within a row.
+func rowConditional(columns []Content) []Content {
+	ids := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		ids[column.ID] = true
+	}
+	var result []Content
+	for _, column := range columns {
+		local := len(column.Conditions) > 0
+		for _, condition := range column.Conditions {
+			local = local && ids[condition.Field]
+		}
+		if local {
+			result = append(result, column)
+		}
+	}
+	return result
+}
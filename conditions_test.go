@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func conditionsForm() Form {
+	return Form{Title: "Order", Sections: []Section{{
+		Title: "main",
+		Content: []Content{
+			{ID: "delivery", Class: "select", Title: "Delivery", Required: true,
+				Options: []Option{{Title: "Courier", Value: "courier"}, {Title: "Pickup", Value: "pickup"}}},
+			{ID: "gift", Class: "check", Title: "Gift"},
+		},
+	}, {
+		Title: "address",
+		Content: []Content{
+			{ID: "street", Class: "edit", Title: "Street", Required: true,
+				Conditions: []Condition{{Field: "delivery", Values: []string{"courier"}}}},
+			{ID: "note", Class: "edit", Title: "Note",
+				Conditions: []Condition{{Field: "gift", Values: []string{"true"}}}},
+		},
+	}}}
+}
+
+func TestConditions_Describe(t *testing.T) {
+	schema, _, err := convertToJSONSchema(conditionsForm(), SchemaOptions{Strict: true})
+	require.NoError(t, err)
+	street := schema.Properties["street"]
+	require.True(t, street.Nullable)
+	require.Equal(t, `Section: address, field: Street, only applies when "Delivery" is "courier", otherwise null`, street.Description)
+	require.Nil(t, schema.AllOf)
+}
+
+func TestConditions_IfThenElse(t *testing.T) {
+	for _, nest := range []bool{false, true} {
+		opts := SchemaOptions{Strict: true, NestSections: nest, Conditions: ConditionsIfThenElse}
+		schema, diagnostics, err := convertToJSONSchema(conditionsForm(), opts)
+		require.NoError(t, err)
+		require.Empty(t, diagnostics)
+		require.Len(t, schema.AllOf, 2)
+
+		answer := map[string]any{"delivery": "pickup", "gift": true, "street": "Main st", "note": "Happy birthday"}
+		if nest {
+			answer = map[string]any{
+				"main":    map[string]any{"delivery": "pickup", "gift": true},
+				"address": map[string]any{"street": "Main st", "note": "Happy birthday"},
+			}
+		}
+		require.NotEmpty(t, validateSchema(schema, answer))
+
+		response, errs, err := checkResponse(schema, answer, true)
+		require.NoError(t, err)
+		require.Empty(t, errs)
+		data, err := convertToFormData(conditionsForm(), response.(map[string]any), opts)
+		require.NoError(t, err)
+		require.Equal(t, "Happy birthday", data["note"])
+		require.NotContains(t, data, "street")
+	}
+}
+
+func TestConditions_FormData(t *testing.T) {
+	_, err := convertToFormData(conditionsForm(), map[string]any{"delivery": "courier", "gift": false, "note": "x"}, SchemaOptions{})
+	require.EqualError(t, err, "street: required field is missing")
+
+	data, err := convertToFormData(conditionsForm(), map[string]any{"delivery": "pickup", "gift": false, "note": "x"}, SchemaOptions{})
+	require.NoError(t, err)
+	require.NotContains(t, data, "note")
+}
+
+func TestConditions_TableColumns(t *testing.T) {
+	form := Form{Title: "Order", Sections: []Section{{
+		Title: "main",
+		Content: []Content{
+			{ID: "items", Class: "table", Title: "Items", Extra: &Extra{Columns: []Content{
+				{ID: "kind", Class: "select", Title: "Kind", Required: true,
+					Options: []Option{{Title: "Goods", Value: "goods"}, {Title: "Service", Value: "service"}}},
+				{ID: "weight", Class: "number", Title: "Weight", Required: true, Extra: &Extra{Precision: intp(0)},
+					Conditions: []Condition{{Field: "kind", Values: []string{"goods"}}}},
+			}}},
+		},
+	}}}
+	opts := SchemaOptions{Strict: true, Conditions: ConditionsIfThenElse}
+	schema, diagnostics, err := convertToJSONSchema(form, opts)
+	require.NoError(t, err)
+	require.Empty(t, diagnostics)
+	require.Nil(t, schema.AllOf)
+	row := schema.Properties["items"].Items
+	require.Len(t, row.AllOf, 1)
+
+	answer := map[string]any{"items": []any{
+		map[string]any{"kind": "goods", "weight": 3.0},
+		map[string]any{"kind": "service", "weight": nil},
+	}}
+	require.Empty(t, validateSchema(schema, answer))
+	require.NotEmpty(t, validateSchema(schema, map[string]any{"items": []any{
+		map[string]any{"kind": "goods", "weight": nil},
+	}}))
+
+	data, err := convertToFormData(form, answer, opts)
+	require.NoError(t, err)
+	require.Equal(t, []map[string]any{{"kind": []map[string]any{{"title": "Goods", "value": "goods"}}, "weight": int64(3)}, {"kind": []map[string]any{{"title": "Service", "value": "service"}}}}, data["items"])
+
+	_, err = convertToFormData(form, map[string]any{"items": []any{map[string]any{"kind": "goods"}}}, SchemaOptions{})
+	require.EqualError(t, err, "items: 0/weight: required field is missing")
+}
+
+func TestUserCode_StructuredOutputConditions(t *testing.T) {
+	bin, err := json.Marshal(conditionsForm())
+	require.NoError(t, err)
+	var form map[string]any
+	require.NoError(t, json.Unmarshal(bin, &form))
+
+	data := map[string]any{"structured_output_req": map[string]any{"forms": form, "conditions": ConditionsIfThenElse}}
+	require.NoError(t, usercode(context.Background(), data))
+	rsp := data["structured_output_rsp"].(map[string]any)
+	require.Len(t, rsp["schema"].(map[string]any)["allOf"], 2)
+
+	data = map[string]any{"structured_output_req": map[string]any{"forms": form}}
+	require.NoError(t, usercode(context.Background(), data))
+	require.NotContains(t, data["structured_output_rsp"].(map[string]any)["schema"], "allOf")
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayouts are the ISO 8601 forms accepted for calendar fields. Layouts
+// without an offset are read in the zone of the reference time.
+var dateLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+var (
+	timeOfDay   = regexp.MustCompile(`^(.*?)\s*(?:at\s+)?(\d{1,2})(?::(\d{2}))?\s*(am|pm)?$`)
+	inDuration  = regexp.MustCompile(`^in\s+(\d+)\s+(minute|hour|day|week|month)s?$`)
+	agoDuration = regexp.MustCompile(`^(\d+)\s+(minute|hour|day|week|month)s?\s+ago$`)
+)
+
+// referenceTime is the time relative dates are resolved against.
+func (o SchemaOptions) referenceTime() time.Time {
+	if o.ReferenceTime.IsZero() {
+		return time.Now()
+	}
+	return o.ReferenceTime
+}
+
+// isoCalendarSchema asks for the start and end of a calendar field as ISO
+// 8601 strings, which models get right far more often than unixtime.
+func isoCalendarSchema(f *Field) SchemaProperty {
+	ref := f.SchemaOptions().referenceTime()
+	return SchemaProperty{
+		Type: "object",
+		Description: f.Description() + ", resolve relative dates against " +
+			ref.Format("Monday, ") + ref.Format(time.RFC3339),
+		AdditionalProperties: new(bool),
+		Properties: map[string]SchemaProperty{
+			"start": {
+				Type:        "string",
+				Format:      "date-time",
+				Description: "Start in ISO 8601 with the UTC offset, e.g. 2024-05-14T15:00:00+02:00",
+			},
+			"end": {
+				Type:        "string",
+				Format:      "date-time",
+				Description: "End in ISO 8601 with the UTC offset, null if the text gives no end",
+				Nullable:    true,
+			},
+		},
+		Required: []string{"start", "end"},
+	}
+}
+
+// calendarISOFormValue converts an ISO 8601 calendar answer into the platform
+// calendar object: unixtime seconds and the offset of the start in minutes
+// east of UTC. A missing end is the start.
+func calendarISOFormValue(raw any, ref time.Time) (map[string]any, error) {
+	obj, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected object, got %T", raw)
+	}
+	s, ok := obj["start"].(string)
+	if !ok {
+		return nil, fmt.Errorf("start: expected string, got %T", obj["start"])
+	}
+	start, err := parseDateTime(s, ref)
+	if err != nil {
+		return nil, fmt.Errorf("start: %w", err)
+	}
+	end := start
+	if obj["end"] != nil {
+		s, ok := obj["end"].(string)
+		if !ok {
+			return nil, fmt.Errorf("end: expected string, got %T", obj["end"])
+		}
+		// A relative end ("at 16:00") is read from the day of the start.
+		if end, err = parseDateTime(s, start); err != nil {
+			return nil, fmt.Errorf("end: %w", err)
+		}
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("end is before start")
+	}
+	_, offset := start.Zone()
+	return map[string]any{
+		"startDate":      start.Unix(),
+		"endDate":        end.Unix(),
+		"timeZoneOffset": int64(offset / 60),
+		"sendInvite":     false,
+	}, nil
+}
+
+// parseDateTime reads an ISO 8601 date or date-time, falling back to the
+// relative forms of resolveRelative.
+func parseDateTime(s string, ref time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, ref.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return resolveRelative(s, ref)
+}
+
+// resolveRelative resolves the relative dates models copy from the text:
+// now, today, tomorrow, yesterday, [this|next|last] <weekday>, next week,
+// next month, in N <unit>s and N <unit>s ago, each optionally followed by a
+// time of day such as "at 15:30" or "3pm". "next Tuesday" is the first
+// Tuesday after the reference day. Dates without a time are at midnight.
+func resolveRelative(s string, ref time.Time) (time.Time, error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), " "))
+	if s == "now" {
+		return ref, nil
+	}
+	if m := inDuration.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return addUnits(ref, n, m[2]), nil
+	}
+	if m := agoDuration.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return addUnits(ref, -n, m[2]), nil
+	}
+
+	day, clock := s, ""
+	if m := timeOfDay.FindStringSubmatch(s); m != nil && (m[3] != "" || m[4] != "") {
+		day, clock = m[1], strings.TrimPrefix(s[len(m[1]):], " ")
+	}
+	date, err := relativeDay(day, ref)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot read date %q", s)
+	}
+	if clock == "" {
+		return date, nil
+	}
+	m := timeOfDay.FindStringSubmatch(clock)
+	hour, _ := strconv.Atoi(m[2])
+	minute, _ := strconv.Atoi(m[3])
+	switch {
+	case m[4] == "pm" && hour < 12:
+		hour += 12
+	case m[4] == "am" && hour == 12:
+		hour = 0
+	}
+	if hour > 23 || minute > 59 {
+		return time.Time{}, fmt.Errorf("cannot read time %q", clock)
+	}
+	return date.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute), nil
+}
+
+// relativeDay returns the midnight of a relative day in the zone of ref.
+func relativeDay(s string, ref time.Time) (time.Time, error) {
+	today := time.Date(ref.Year(), ref.Month(), ref.Day(), 0, 0, 0, 0, ref.Location())
+	switch s {
+	case "", "today":
+		return today, nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	case "day after tomorrow":
+		return today.AddDate(0, 0, 2), nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case "next week":
+		return today.AddDate(0, 0, 7), nil
+	case "next month":
+		return today.AddDate(0, 1, 0), nil
+	}
+	modifier, name, found := strings.Cut(s, " ")
+	if !found {
+		modifier, name = "this", s
+	}
+	weekday, ok := weekdays[name]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unknown day %q", s)
+	}
+	diff := int(weekday - today.Weekday())
+	switch modifier {
+	case "this", "on":
+		diff = (diff + 7) % 7
+	case "next":
+		diff = (diff+6)%7 + 1
+	case "last":
+		diff = -((-diff+6)%7 + 1)
+	default:
+		return time.Time{}, fmt.Errorf("unknown day %q", s)
+	}
+	return today.AddDate(0, 0, diff), nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+func addUnits(t time.Time, n int, unit string) time.Time {
+	switch unit {
+	case "minute":
+		return t.Add(time.Duration(n) * time.Minute)
+	case "hour":
+		return t.Add(time.Duration(n) * time.Hour)
+	case "day":
+		return t.AddDate(0, 0, n)
+	case "week":
+		return t.AddDate(0, 0, 7*n)
+	}
+	return t.AddDate(0, n, 0)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveRelative(t *testing.T) {
+	zone := time.FixedZone("", 2*60*60)
+	// A Thursday.
+	ref := time.Date(2024, 5, 16, 10, 30, 0, 0, zone)
+	for s, expected := range map[string]time.Time{
+		"2024-05-20T09:00:00Z":    time.Date(2024, 5, 20, 9, 0, 0, 0, time.UTC),
+		"2024-05-20 09:00":        time.Date(2024, 5, 20, 9, 0, 0, 0, zone),
+		"2024-05-20":              time.Date(2024, 5, 20, 0, 0, 0, 0, zone),
+		"now":                     ref,
+		"Tomorrow at 3pm":         time.Date(2024, 5, 17, 15, 0, 0, 0, zone),
+		"next Tuesday at 15:30":   time.Date(2024, 5, 21, 15, 30, 0, 0, zone),
+		"next thursday":           time.Date(2024, 5, 23, 0, 0, 0, 0, zone),
+		"thursday":                time.Date(2024, 5, 16, 0, 0, 0, 0, zone),
+		"last monday":             time.Date(2024, 5, 13, 0, 0, 0, 0, zone),
+		"in 2 hours":              time.Date(2024, 5, 16, 12, 30, 0, 0, zone),
+		"3 days ago":              time.Date(2024, 5, 13, 10, 30, 0, 0, zone),
+		"day after tomorrow 12am": time.Date(2024, 5, 18, 0, 0, 0, 0, zone),
+	} {
+		actual, err := parseDateTime(s, ref)
+		require.NoError(t, err, s)
+		require.True(t, expected.Equal(actual), "%s: %v", s, actual)
+	}
+	_, err := parseDateTime("someday", ref)
+	require.EqualError(t, err, `cannot read date "someday"`)
+}
+
+func TestCalendarISO(t *testing.T) {
+	ref := time.Date(2024, 5, 16, 10, 30, 0, 0, time.FixedZone("", 2*60*60))
+	opts := SchemaOptions{Strict: true, ISODates: true, ReferenceTime: ref}
+	schema, _, err := convertToJSONSchema(dataForm(), opts)
+	require.NoError(t, err)
+	due := schema.Properties["due"]
+	require.Equal(t, []string{"start", "end"}, due.Required)
+	require.Contains(t, due.Description, "Thursday, 2024-05-16T10:30:00+02:00")
+
+	data, err := convertToFormData(dataForm(), map[string]any{
+		"name": "Sync",
+		"due":  map[string]any{"start": "next tuesday at 15:00", "end": "16:00"},
+	}, opts)
+	require.NoError(t, err)
+	start := time.Date(2024, 5, 21, 15, 0, 0, 0, ref.Location())
+	require.Equal(t, map[string]any{
+		"startDate":      start.Unix(),
+		"endDate":        start.Add(time.Hour).Unix(),
+		"timeZoneOffset": int64(120),
+		"sendInvite":     false,
+	}, data["due"])
+
+	_, err = convertToFormData(dataForm(), map[string]any{
+		"name": "Sync",
+		"due":  map[string]any{"start": "2024-05-21T15:00:00+02:00", "end": "2024-05-21T14:00:00+02:00"},
+	}, opts)
+	require.ErrorContains(t, err, "due: end is before start")
+}
+
+func TestSchemaOptions_ReferenceTime(t *testing.T) {
+	opts, err := schemaOptions(map[string]any{"iso_dates": true, "reference_time": "2024-05-17T10:00:00+02:00"})
+	require.NoError(t, err)
+	require.True(t, opts.ISODates)
+	require.Equal(t, "2024-05-17T08:00:00Z", opts.ReferenceTime.UTC().Format(time.RFC3339))
+
+	_, err = schemaOptions(map[string]any{"reference_time": "17.05.2024"})
+	require.ErrorContains(t, err, "reference_time: parsing time")
+}
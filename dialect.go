@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Structured output dialects a form schema can be exported in.
+const (
+	DialectOpenAI    = "openai"
+	DialectAnthropic = "anthropic"
+	DialectGemini    = "gemini"
+	DialectJSONMode  = "json_mode"
+)
+
+// openAIFormats are the string formats OpenAI strict mode accepts.
+var openAIFormats = map[string]bool{
+	"date-time": true, "time": true, "date": true, "duration": true, "email": true,
+	"hostname": true, "ipv4": true, "ipv6": true, "uuid": true,
+}
+
+// exportSchema returns the request fragment that makes the given provider
+// answer with schema:
+//   - openai: the response_format object with a strict json_schema;
+//   - anthropic: a tool definition whose input_schema is the schema;
+//   - gemini: generationConfig fields with responseSchema in the OpenAPI subset;
+//   - json_mode: a json_object response_format and a prompt describing the fields.
+func exportSchema(schema SchemaProperty, name, dialect string, strict bool) (map[string]any, error) {
+	node, err := schemaMap(schema)
+	if err != nil {
+		return nil, err
+	}
+	switch dialect {
+	case "", DialectOpenAI:
+		return map[string]any{
+			"type": "json_schema",
+			"json_schema": map[string]any{
+				"name":   name,
+				"strict": strict,
+				"schema": adaptOpenAI(node),
+			},
+		}, nil
+	case DialectAnthropic:
+		return map[string]any{
+			"name":         name,
+			"description":  "Record the structured output extracted from the text",
+			"input_schema": node,
+		}, nil
+	case DialectGemini:
+		return map[string]any{
+			"responseMimeType": "application/json",
+			"responseSchema":   adaptGemini(node),
+		}, nil
+	case DialectJSONMode:
+		return map[string]any{
+			"response_format": map[string]any{"type": "json_object"},
+			"prompt":          jsonModePrompt(node),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown dialect %s", dialect)
+}
+
+// schemaMap turns a SchemaProperty into plain JSON values that can be rewritten.
+func schemaMap(schema SchemaProperty) (map[string]any, error) {
+	bin, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	var node map[string]any
+	err = json.Unmarshal(bin, &node)
+	return node, err
+}
+
+// walkSchema applies fn to node and then to all of its nested schemas.
+func walkSchema(node map[string]any, fn func(map[string]any)) {
+	fn(node)
+	if properties, ok := node["properties"].(map[string]any); ok {
+		for _, p := range properties {
+			if property, ok := p.(map[string]any); ok {
+				walkSchema(property, fn)
+			}
+		}
+	}
+	if items, ok := node["items"].(map[string]any); ok {
+		walkSchema(items, fn)
+	}
+	if anyOf, ok := node["anyOf"].([]any); ok {
+		for _, b := range anyOf {
+			if branch, ok := b.(map[string]any); ok {
+				walkSchema(branch, fn)
+			}
+		}
+	}
+}
+
+// adaptOpenAI drops the keywords strict mode rejects: oneOf titles and
+// unsupported formats move into the description, uniqueItems and the
+// allOf of field conditions are removed.
+func adaptOpenAI(node map[string]any) map[string]any {
+	// Conditions are described in the field descriptions already.
+	delete(node, "allOf")
+	walkSchema(node, func(n map[string]any) {
+		foldOneOf(n)
+		delete(n, "uniqueItems")
+		if format, ok := n["format"].(string); ok && !openAIFormats[format] {
+			delete(n, "format")
+			appendDescription(n, "format: "+format)
+		}
+	})
+	return node
+}
+
+// adaptGemini rewrites the schema into the OpenAPI 3.0 subset Gemini takes:
+// nullable instead of type unions, no null in enums, no additionalProperties,
+// oneOf, uniqueItems, pattern or condition allOf, and an explicit propertyOrdering.
+func adaptGemini(node map[string]any) map[string]any {
+	delete(node, "allOf")
+	walkSchema(node, func(n map[string]any) {
+		if types, ok := n["type"].([]any); ok {
+			for _, t := range types {
+				if t == "null" {
+					n["nullable"] = true
+				} else {
+					n["type"] = t
+				}
+			}
+		}
+		if enum, ok := n["enum"].([]any); ok {
+			values := make([]any, 0, len(enum))
+			for _, v := range enum {
+				if v != nil {
+					values = append(values, v)
+				}
+			}
+			n["enum"] = values
+			n["format"] = "enum"
+		}
+		foldOneOf(n)
+		if pattern, ok := n["pattern"].(string); ok {
+			delete(n, "pattern")
+			appendDescription(n, "pattern: "+pattern)
+		}
+		if format, ok := n["format"].(string); ok && format != "enum" && format != "date-time" {
+			delete(n, "format")
+			appendDescription(n, "format: "+format)
+		}
+		delete(n, "additionalProperties")
+		delete(n, "uniqueItems")
+		if required, ok := n["required"].([]any); ok && n["properties"] != nil {
+			n["propertyOrdering"] = required
+		}
+	})
+	return node
+}
+
+// foldOneOf replaces oneOf option titles by a description next to the enum.
+func foldOneOf(n map[string]any) {
+	oneOf, ok := n["oneOf"].([]any)
+	if !ok {
+		return
+	}
+	delete(n, "oneOf")
+	options := make([]string, 0, len(oneOf))
+	for _, o := range oneOf {
+		option, _ := o.(map[string]any)
+		if option == nil || option["const"] == nil {
+			continue
+		}
+		value := fmt.Sprint(option["const"])
+		if title, _ := option["title"].(string); title != "" && title != value {
+			options = append(options, value+" = "+title)
+		}
+	}
+	if len(options) > 0 {
+		appendDescription(n, "options: "+strings.Join(options, "; "))
+	}
+}
+
+func appendDescription(n map[string]any, text string) {
+	if description, _ := n["description"].(string); description != "" {
+		n["description"] = description + ", " + text
+		return
+	}
+	n["description"] = text
+}
+
+// jsonModePrompt describes the fields of the schema for providers that only
+// support plain JSON output.
+func jsonModePrompt(node map[string]any) string {
+	var b strings.Builder
+	b.WriteString("Respond with a single JSON object and nothing else. Use exactly these keys:\n")
+	describeFields(&b, node, "")
+	b.WriteString("Use null for optional values that are not present in the text.")
+	return b.String()
+}
+
+func describeFields(b *strings.Builder, node map[string]any, indent string) {
+	properties, _ := node["properties"].(map[string]any)
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	order := make(map[string]int)
+	if required, ok := node["required"].([]any); ok {
+		for i, r := range required {
+			if key, ok := r.(string); ok {
+				order[key] = i + 1
+			}
+		}
+	}
+	// Required keys keep their form order, the others follow by name.
+	sort.Slice(keys, func(i, j int) bool {
+		oi, oj := order[keys[i]], order[keys[j]]
+		switch {
+		case oi == oj:
+			return keys[i] < keys[j]
+		case oi == 0:
+			return false
+		case oj == 0:
+			return true
+		}
+		return oi < oj
+	})
+	for _, key := range keys {
+		property, _ := properties[key].(map[string]any)
+		fmt.Fprintf(b, "%s- %q (%s)", indent, key, describeType(property))
+		if description, _ := property["description"].(string); description != "" {
+			b.WriteString(": " + description)
+		}
+		if format, ok := property["format"].(string); ok {
+			fmt.Fprintf(b, "; format %s", format)
+		}
+		if enum, ok := property["enum"].([]any); ok {
+			fmt.Fprintf(b, "; one of %s", enumList(enum))
+		}
+		b.WriteString("\n")
+		if items, ok := property["items"].(map[string]any); ok {
+			if enum, ok := items["enum"].([]any); ok {
+				fmt.Fprintf(b, "%s  items: one of %s\n", indent, enumList(enum))
+			}
+			if items["properties"] != nil {
+				describeFields(b, items, indent+"  ")
+			}
+		}
+		if property["properties"] != nil {
+			describeFields(b, property, indent+"  ")
+		}
+	}
+}
+
+func describeType(property map[string]any) string {
+	switch t := property["type"].(type) {
+	case string:
+		return t
+	case []any:
+		types := make([]string, 0, len(t))
+		for _, v := range t {
+			types = append(types, fmt.Sprint(v))
+		}
+		return strings.Join(types, " or ")
+	}
+	return "any"
+}
+
+func enumList(enum []any) string {
+	values := make([]string, 0, len(enum))
+	for _, v := range enum {
+		bin, _ := json.Marshal(v)
+		values = append(values, string(bin))
+	}
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func dialectSchema(t *testing.T) SchemaProperty {
+	f := Form{Sections: []Section{{
+		Title: "main",
+		Content: []Content{
+			{ID: "site", Class: "url", Title: "Site", Required: true},
+			{ID: "color", Class: "select", Title: "Color", Options: []Option{{Title: "Red", Value: "r"}}},
+		},
+	}}}
+	schema, _, err := convertToJSONSchema(f, SchemaOptions{Strict: true})
+	require.NoError(t, err)
+	return schema
+}
+
+func requireJSON(t *testing.T, expected string, actual any) {
+	bin, err := json.Marshal(actual)
+	require.NoError(t, err)
+	require.JSONEq(t, expected, string(bin))
+}
+
+func TestExportSchema_OpenAI(t *testing.T) {
+	format, err := exportSchema(dialectSchema(t), "structured_output", DialectOpenAI, true)
+	require.NoError(t, err)
+	requireJSON(t, `{
+		"type": "json_schema",
+		"json_schema": {
+			"name": "structured_output",
+			"strict": true,
+			"schema": {
+				"type": "object",
+				"additionalProperties": false,
+				"required": ["site", "color"],
+				"properties": {
+					"site": {"type": "string", "description": "Section: main, field: Site, format: uri"},
+					"color": {
+						"type": ["string", "null"],
+						"description": "Section: main, field: Color, null if not present in the text, options: r = Red",
+						"enum": ["r", null]
+					}
+				}
+			}
+		}
+	}`, format)
+}
+
+func TestExportSchema_Gemini(t *testing.T) {
+	format, err := exportSchema(dialectSchema(t), "structured_output", DialectGemini, true)
+	require.NoError(t, err)
+	requireJSON(t, `{
+		"responseMimeType": "application/json",
+		"responseSchema": {
+			"type": "object",
+			"required": ["site", "color"],
+			"propertyOrdering": ["site", "color"],
+			"properties": {
+				"site": {"type": "string", "description": "Section: main, field: Site, format: uri"},
+				"color": {
+					"type": "string",
+					"nullable": true,
+					"format": "enum",
+					"description": "Section: main, field: Color, null if not present in the text, options: r = Red",
+					"enum": ["r"]
+				}
+			}
+		}
+	}`, format)
+}
+
+func TestExportSchema_AnthropicAndJSONMode(t *testing.T) {
+	format, err := exportSchema(dialectSchema(t), "structured_output", DialectAnthropic, true)
+	require.NoError(t, err)
+	require.Equal(t, "structured_output", format["name"])
+	require.Contains(t, format["input_schema"].(map[string]any)["properties"], "color")
+
+	format, err = exportSchema(dialectSchema(t), "structured_output", DialectJSONMode, true)
+	require.NoError(t, err)
+	require.Equal(t, `Respond with a single JSON object and nothing else. Use exactly these keys:
+- "site" (string): Section: main, field: Site; format uri
+- "color" (string or null): Section: main, field: Color, null if not present in the text; one of "r", null
+Use null for optional values that are not present in the text.`, format["prompt"])
+
+	_, err = exportSchema(dialectSchema(t), "structured_output", "cohere", true)
+	require.EqualError(t, err, "unknown dialect cohere")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// hierarchyEdgeType links the graph actor to its layer.
+const hierarchyEdgeType = "hierarchy"
+
+// edgeTypes reads the edge type IDs by name from a GetTypeLinks response.
+func edgeTypes(rsp map[string]any) (map[string]int, error) {
+	links, ok := rsp["data"].([]any)
+	if !ok {
+		return nil, fmt.Errorf("no edge types in response: %v", rsp["error"])
+	}
+	types := make(map[string]int, len(links))
+	for _, l := range links {
+		link, ok := l.(map[string]any)
+		if !ok {
+			continue
+		}
+		name, _ := link["name"].(string)
+		id, ok := link["id"].(float64)
+		if name == "" || !ok {
+			continue
+		}
+		if _, seen := types[name]; !seen {
+			types[name] = int(id)
+		}
+	}
+	return types, nil
+}
+
+func edgeTypeNames(types map[string]int) []string {
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// edgeTypedSchema is the graph schema whose edges take one of the edge types
+// of the workspace.
+func edgeTypedSchema(types map[string]int) SchemaProperty {
+	// A fresh copy, graphSchema shares its maps.
+	schema := mustSchemaProperty(Schema)
+	edge := *schema.Properties["edges"].Items
+	property := edge.Properties["type"]
+	names := edgeTypeNames(types)
+	property.Enum = &names
+	edge.Properties["type"] = property
+	return schema
+}
+
+// hierarchyType is the ID of the hierarchyEdgeType of types. Without it the
+// graph actor cannot be linked to its layer, so its absence is an error.
+func hierarchyType(workspaceID string, types map[string]int) (int, error) {
+	id, ok := types[hierarchyEdgeType]
+	if !ok {
+		return 0, fmt.Errorf("workspace %s has no %q edge type, create it to link the graph to its layer", workspaceID, hierarchyEdgeType)
+	}
+	return id, nil
+}
+
+// linkType is the edge type ID of e, the graph's own link type for types
+// the workspace does not have.
+func (req Request) linkType(e Edge) int {
+	if id, ok := req.EdgeTypes[e.Type]; ok {
+		return id
+	}
+	return req.LinkType
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEdgeTypes(t *testing.T) {
+	types, err := edgeTypes(map[string]any{"data": []any{
+		map[string]any{"id": 3.0, "name": "hierarchy"},
+		map[string]any{"id": 5.0, "name": "employment"},
+		map[string]any{"id": 6.0, "name": "employment"},
+		map[string]any{"id": 7.0},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"hierarchy": 3, "employment": 5}, types)
+
+	_, err = edgeTypes(map[string]any{"error": "forbidden"})
+	require.EqualError(t, err, "no edge types in response: forbidden")
+
+	id, err := hierarchyType("w1", types)
+	require.NoError(t, err)
+	require.Equal(t, 3, id)
+	_, err = hierarchyType("w1", map[string]int{"employment": 5})
+	require.EqualError(t, err, `workspace w1 has no "hierarchy" edge type, create it to link the graph to its layer`)
+
+	req := Request{LinkType: 3, EdgeTypes: types}
+	require.Equal(t, 5, req.linkType(Edge{Type: "employment"}))
+	require.Equal(t, 3, req.linkType(Edge{Type: "ownership"}))
+}
+
+func TestEdgeTypedSchema(t *testing.T) {
+	schema := edgeTypedSchema(map[string]int{"hierarchy": 3, "employment": 5})
+	require.Equal(t, &[]string{"employment", "hierarchy"}, schema.Properties["edges"].Items.Properties["type"].Enum)
+	require.Nil(t, graphSchema.Properties["edges"].Items.Properties["type"].Enum)
+
+	edge := `{"source": "1", "target": "2", "type": "%s", "label": "works for", "directed": true, "weight": 1}`
+	node := `{"id": "%s", "name": "%s", "type": "", "description": "", "attributes": [], "x": 0, "y": 0}`
+	content := `{"nodes": [` + fmt.Sprintf(node, "1", "Bob") + `, ` + fmt.Sprintf(node, "2", "Acme") + `], "edges": [` + fmt.Sprintf(edge, "employment") + `]}`
+	graph, err := parseGraph(schema, content)
+	require.NoError(t, err)
+	require.Equal(t, "employment", graph.Edges[0].Type)
+
+	content = `{"nodes": [` + fmt.Sprintf(node, "1", "Bob") + `, ` + fmt.Sprintf(node, "2", "Acme") + `], "edges": [` + fmt.Sprintf(edge, "ownership") + `]}`
+	_, err = parseGraph(schema, content)
+	require.ErrorContains(t, err, "/edges/0/type")
+}
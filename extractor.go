@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// Graph extraction backends, picked by graph_maker_req.provider.
+const (
+	ProviderOpenAI = "openai"
+	// ProviderOpenAICompatible is any server speaking the Chat Completions
+	// API with JSON schema response formats: vLLM, Ollama, llama.cpp server.
+	ProviderOpenAICompatible = "openai_compatible"
+)
+
+// GraphExtractor extracts the graph of a text in the shape of schema.
+type GraphExtractor interface {
+	ExtractGraph(ctx context.Context, schema SchemaProperty, systemMsg, text string) (Graph, error)
+}
+
+// chatBackend is a GraphExtractor that answers other structured output
+// requests too, so the later steps of a request use the same backend.
+type chatBackend interface {
+	Chat(ctx context.Context, req ChatRequest) (string, error)
+}
+
+// chatExtractor extracts graphs through the structured output of a Chat
+// Completions API.
+type chatExtractor struct {
+	client *openai.Client
+	params GraphParams
+}
+
+func (e chatExtractor) ExtractGraph(ctx context.Context, schema SchemaProperty, systemMsg, text string) (Graph, error) {
+	content, err := chatCompletion(ctx, e.client, ChatRequest{
+		Model:       e.params.Model,
+		SystemMsg:   systemMsg,
+		UserMsg:     text,
+		SchemaName:  "structured_output",
+		Schema:      schema,
+		Strict:      true,
+		Temperature: e.params.Temperature,
+		TopP:        e.params.TopP,
+		Seed:        e.params.Seed,
+		MaxTokens:   e.params.MaxTokens,
+	})
+	if err != nil {
+		return Graph{}, err
+	}
+	return parseGraph(schema, content)
+}
+
+func (e chatExtractor) Chat(ctx context.Context, req ChatRequest) (string, error) {
+	return chatCompletion(ctx, e.client, req)
+}
+
+// newOpenAIExtractor extracts graphs with an OpenAI model.
+func newOpenAIExtractor(apiKey string, params GraphParams) GraphExtractor {
+	return chatExtractor{client: openai.NewClient(option.WithAPIKey(apiKey)), params: params}
+}
+
+// newCompatibleExtractor extracts graphs with a model served at baseURL.
+// Self-hosted servers often need no API key.
+func newCompatibleExtractor(baseURL, apiKey string, params GraphParams) GraphExtractor {
+	opts := []option.RequestOption{option.WithBaseURL(baseURL)}
+	if apiKey != "" {
+		opts = append(opts, option.WithAPIKey(apiKey))
+	}
+	return chatExtractor{client: openai.NewClient(opts...), params: params}
+}
+
+// newGraphExtractor is the backend req asks for, OpenAI by default.
+// req.Params are expected to be checked by graphParams.
+func newGraphExtractor(req Request) (GraphExtractor, error) {
+	switch req.Provider {
+	case "", ProviderOpenAI:
+		if req.OpenAPIKey == "" {
+			return nil, fmt.Errorf("no open_api_key field")
+		}
+		return newOpenAIExtractor(req.OpenAPIKey, req.Params), nil
+	case ProviderOpenAICompatible:
+		if req.BaseURL == "" {
+			return nil, fmt.Errorf("no base_url field for provider %s", req.Provider)
+		}
+		if req.Params.Model == "" {
+			return nil, fmt.Errorf("no model field for provider %s", req.Provider)
+		}
+		return newCompatibleExtractor(req.BaseURL, req.APIKey, req.Params), nil
+	}
+	return nil, fmt.Errorf("unknown provider %q, expected %s or %s", req.Provider, ProviderOpenAI, ProviderOpenAICompatible)
+}
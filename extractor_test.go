@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedExtractor answers with graphs in order and records the texts it got.
+type scriptedExtractor struct {
+	graphs []Graph
+	texts  []string
+}
+
+func (e *scriptedExtractor) ExtractGraph(_ context.Context, _ SchemaProperty, _, text string) (Graph, error) {
+	e.texts = append(e.texts, text)
+	if len(e.texts) > len(e.graphs) {
+		return Graph{}, fmt.Errorf("unexpected extraction %d", len(e.texts))
+	}
+	return e.graphs[len(e.texts)-1], nil
+}
+
+func TestNewGraphExtractor(t *testing.T) {
+	_, err := newGraphExtractor(Request{})
+	require.EqualError(t, err, "no open_api_key field")
+	e, err := newGraphExtractor(Request{OpenAPIKey: "key", Params: GraphParams{Model: graphModel}})
+	require.NoError(t, err)
+	require.Equal(t, graphModel, e.(chatExtractor).params.Model)
+
+	_, err = newGraphExtractor(Request{Provider: ProviderOpenAICompatible, Params: GraphParams{Model: "llama3"}})
+	require.EqualError(t, err, "no base_url field for provider openai_compatible")
+	_, err = newGraphExtractor(Request{Provider: ProviderOpenAICompatible, BaseURL: "http://localhost:11434/v1/"})
+	require.EqualError(t, err, "no model field for provider openai_compatible")
+	_, err = newGraphExtractor(Request{Provider: "anthropic"})
+	require.ErrorContains(t, err, `unknown provider "anthropic"`)
+}
+
+func TestCompatibleExtractor(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/chat/completions", r.URL.Path)
+		require.Empty(t, r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id": "1", "object": "chat.completion", "model": "llama3", "choices": [{"index": 0,
+			"finish_reason": "stop", "message": {"role": "assistant",
+			"content": "{\"nodes\": [{\"id\": \"1\", \"name\": \"Acme\", \"type\": \"organization\", \"description\": \"\", \"attributes\": [], \"x\": 0, \"y\": 0}], \"edges\": []}"}}]}`)
+	}))
+	defer server.Close()
+
+	seed, temperature := int64(7), 0.0
+	e, err := newGraphExtractor(Request{Provider: ProviderOpenAICompatible, BaseURL: server.URL + "/v1/",
+		Params: GraphParams{Model: "llama3", Seed: &seed, Temperature: &temperature}})
+	require.NoError(t, err)
+	graph, err := e.ExtractGraph(context.Background(), graphSchema, "graph", "Acme hires.")
+	require.NoError(t, err)
+	require.Equal(t, []Node{{ID: "1", Name: "Acme", Type: "organization", Attributes: []Attribute{}}}, graph.Nodes)
+	require.Equal(t, "llama3", body["model"])
+	require.Equal(t, 7.0, body["seed"])
+	require.Equal(t, 0.0, body["temperature"])
+	require.NotContains(t, body, "top_p")
+	require.Equal(t, "json_schema", body["response_format"].(map[string]any)["type"])
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// FieldConverter maps one form field class onto a JSON Schema property and
+// maps the model's answer for that field back into platform form data.
+type FieldConverter interface {
+	// Schema returns the schema of the field; ok is false when the field is left out.
+	Schema(f *Field) (schema SchemaProperty, ok bool, err error)
+	// FormData converts the model value of the field into its platform form data value.
+	FormData(f *Field, raw any) (any, error)
+}
+
+var fieldConverters = make(map[string]FieldConverter)
+
+// RegisterFieldConverter makes a field class known to the converters. Custom
+// classes are registered from an init function in a separate file; a class
+// registered twice is overridden by the last registration.
+func RegisterFieldConverter(class string, c FieldConverter) {
+	fieldConverters[class] = c
+}
+
+func init() {
+	RegisterFieldConverter("edit", editConverter{})
+	RegisterFieldConverter("check", checkConverter{})
+	RegisterFieldConverter("calendar", calendarConverter{})
+	RegisterFieldConverter("select", selectConverter{})
+	RegisterFieldConverter("multiSelect", selectConverter{multi: true})
+	RegisterFieldConverter("upload", uploadConverter{})
+	RegisterFieldConverter("radio", selectConverter{})
+	RegisterFieldConverter("link", selectConverter{multi: true, hint: ", values: IDs of the linked actors"})
+	RegisterFieldConverter("number", numberConverter{})
+	RegisterFieldConverter("currency", numberConverter{currency: true})
+	RegisterFieldConverter("rating", ratingConverter{})
+	RegisterFieldConverter("table", tableConverter{})
+	RegisterFieldConverter("phone", textConverter{pattern: phonePattern})
+	RegisterFieldConverter("email", textConverter{format: "email", check: checkEmail})
+	RegisterFieldConverter("url", textConverter{format: "uri", check: checkURL})
+}
+
+// Diagnostic describes a field the converter skipped or degraded.
+type Diagnostic struct {
+	Field   string `json:"field"`
+	Class   string `json:"class"`
+	Section string `json:"section,omitempty"`
+	Message string `json:"message"`
+}
+
+// conversion holds the state shared by all fields of one form conversion.
+type conversion struct {
+	opts        SchemaOptions
+	options     *optionResolver
+	diagnostics []Diagnostic
+	// fields locates the fields of the sections being converted.
+	fields      map[string]fieldLocation
+	conditional []conditionalField
+}
+
+func newConversion(opts SchemaOptions) *conversion {
+	return &conversion{
+		opts:        opts,
+		options:     newOptionResolver(opts.MaxFilterOptions),
+		diagnostics: make([]Diagnostic, 0),
+	}
+}
+
+// fork returns a conversion sharing the resolved options of c but with its
+// own diagnostics.
+func (c *conversion) fork() *conversion {
+	return &conversion{
+		opts:        c.opts,
+		options:     c.options,
+		diagnostics: make([]Diagnostic, 0),
+	}
+}
+
+func (c *conversion) field(section string, item Content) *Field {
+	return &Field{Content: item, Section: section, conv: c}
+}
+
+// Field is a form item being converted, together with its section title.
+type Field struct {
+	Content
+	Section string
+	conv    *conversion
+}
+
+// Description is the default schema description of the field.
+func (f *Field) Description() string {
+	return "Section: " + f.Section + ", field: " + f.Title
+}
+
+// Options resolves the select options of the field, including actor filters.
+func (f *Field) Options() ([]Option, error) {
+	return f.conv.options.resolve(f.Content)
+}
+
+// SchemaOptions returns the options of the running conversion.
+func (f *Field) SchemaOptions() SchemaOptions {
+	return f.conv.opts
+}
+
+// Warn records a diagnostic for the field.
+func (f *Field) Warn(format string, args ...any) {
+	f.conv.diagnostics = append(f.conv.diagnostics, Diagnostic{
+		Field:   f.ID,
+		Class:   f.Class,
+		Section: f.Section,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+type editConverter struct{}
+
+func (editConverter) Schema(f *Field) (SchemaProperty, bool, error) {
+	return SchemaProperty{
+		Type:        "string",
+		Description: f.Description(),
+	}, true, nil
+}
+
+func (editConverter) FormData(f *Field, raw any) (any, error) {
+	s, ok := raw.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected string, got %T", raw)
+	}
+	return s, nil
+}
+
+type checkConverter struct{}
+
+func (checkConverter) Schema(f *Field) (SchemaProperty, bool, error) {
+	return SchemaProperty{
+		Type:        "boolean",
+		Description: f.Description(),
+	}, true, nil
+}
+
+func (checkConverter) FormData(f *Field, raw any) (any, error) {
+	b, ok := raw.(bool)
+	if !ok {
+		return nil, fmt.Errorf("expected boolean, got %T", raw)
+	}
+	return b, nil
+}
+
+type calendarConverter struct{}
+
+func (calendarConverter) Schema(f *Field) (SchemaProperty, bool, error) {
+	if f.SchemaOptions().ISODates {
+		return isoCalendarSchema(f), true, nil
+	}
+	return SchemaProperty{
+		Type:                 "object",
+		Description:          f.Description(),
+		AdditionalProperties: new(bool),
+		Properties: map[string]SchemaProperty{
+			"startDate": {
+				Type:        "integer",
+				Description: "Date and time in unixtime",
+			},
+			"endDate": {
+				Type:        "integer",
+				Description: "Date and time in unixtime",
+			},
+			"timeZoneOffset": {
+				Type:        "integer",
+				Description: "time Zone Offset",
+			},
+		},
+		Required: []string{
+			"startDate",
+			"endDate",
+			"timeZoneOffset",
+		},
+	}, true, nil
+}
+
+// FormData sets sendInvite itself, the model is never asked for it.
+func (calendarConverter) FormData(f *Field, raw any) (any, error) {
+	if opts := f.SchemaOptions(); opts.ISODates {
+		return calendarISOFormValue(raw, opts.referenceTime())
+	}
+	return calendarFormValue(raw)
+}
+
+type selectConverter struct {
+	multi bool
+	hint  string
+}
+
+func (c selectConverter) Schema(f *Field) (SchemaProperty, bool, error) {
+	description := f.Description() + c.hint
+	options, err := f.Options()
+	if errors.Is(err, errFilterTooLarge) {
+		f.Warn("%v, falling back to a free-form actor ID", err)
+		description += ", value: ID of an actor from filter " + f.Extra.OptionsSource.Value.ID
+	} else if err != nil {
+		return SchemaProperty{}, false, err
+	}
+
+	schema := SchemaProperty{
+		Type:        "string",
+		Description: description,
+		Enum:        optionEnum(options),
+		OneOf:       optionOneOf(options),
+	}
+	if c.multi {
+		items := schema
+		items.Description = ""
+		schema = SchemaProperty{
+			Type:        "array",
+			Description: description,
+			Items:       &items,
+			UniqueItems: true,
+		}
+		schema.MinItems, schema.MaxItems = itemCounts(f.Content, len(options))
+	}
+	return schema, true, nil
+}
+
+func (c selectConverter) FormData(f *Field, raw any) (any, error) {
+	var values []string
+	if c.multi {
+		var err error
+		if values, err = multiSelectValues(raw); err != nil {
+			return nil, err
+		}
+	} else {
+		s, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string, got %T", raw)
+		}
+		values = []string{s}
+	}
+	options, err := f.Options()
+	if err != nil && !errors.Is(err, errFilterTooLarge) {
+		return nil, err
+	}
+	return selectFormValue(options, values)
+}
+
+// uploadConverter leaves files out: the model cannot produce them.
+type uploadConverter struct{}
+
+func (uploadConverter) Schema(f *Field) (SchemaProperty, bool, error) {
+	return SchemaProperty{}, false, nil
+}
+
+func (uploadConverter) FormData(f *Field, raw any) (any, error) {
+	return nil, fmt.Errorf("uploads are not filled from structured output")
+}
+
+// numberConverter handles numeric inputs and currency amounts. Fields with a
+// precision of 0 are integers; currency amounts default to 2 decimal places.
+type numberConverter struct {
+	currency bool
+}
+
+func (c numberConverter) precision(f *Field) int {
+	if f.Extra != nil && f.Extra.Precision != nil {
+		return *f.Extra.Precision
+	}
+	if c.currency {
+		return 2
+	}
+	return -1
+}
+
+func (c numberConverter) Schema(f *Field) (SchemaProperty, bool, error) {
+	schema := SchemaProperty{
+		Type:        "number",
+		Description: f.Description(),
+	}
+	if c.precision(f) == 0 {
+		schema.Type = "integer"
+	}
+	if f.Extra != nil {
+		schema.Minimum, schema.Maximum = f.Extra.Min, f.Extra.Max
+		if c.currency && f.Extra.Currency != "" {
+			schema.Description += ", amount in " + f.Extra.Currency
+		}
+	}
+	return schema, true, nil
+}
+
+func (c numberConverter) FormData(f *Field, raw any) (any, error) {
+	n, ok := raw.(float64)
+	if !ok {
+		return nil, fmt.Errorf("expected number, got %T", raw)
+	}
+	if f.Extra != nil {
+		if err := checkBounds(n, f.Extra.Min, f.Extra.Max); err != nil {
+			return nil, err
+		}
+	}
+	switch precision := c.precision(f); {
+	case precision == 0:
+		if n != math.Trunc(n) {
+			return nil, fmt.Errorf("expected integer, got %v", n)
+		}
+		return int64(n), nil
+	case precision > 0:
+		scale := math.Pow(10, float64(precision))
+		return math.Round(n*scale) / scale, nil
+	}
+	return n, nil
+}
+
+const (
+	defaultRatingMin = 1.0
+	defaultRatingMax = 5.0
+)
+
+// ratingConverter handles rating sliders: an integer between min and max,
+// 1 to 5 unless the form says otherwise.
+type ratingConverter struct{}
+
+func (ratingConverter) bounds(f *Field) (float64, float64) {
+	min, max := defaultRatingMin, defaultRatingMax
+	if f.Extra != nil && f.Extra.Min != nil {
+		min = *f.Extra.Min
+	}
+	if f.Extra != nil && f.Extra.Max != nil {
+		max = *f.Extra.Max
+	}
+	return min, max
+}
+
+func (c ratingConverter) Schema(f *Field) (SchemaProperty, bool, error) {
+	min, max := c.bounds(f)
+	return SchemaProperty{
+		Type:        "integer",
+		Description: f.Description(),
+		Minimum:     &min,
+		Maximum:     &max,
+	}, true, nil
+}
+
+func (c ratingConverter) FormData(f *Field, raw any) (any, error) {
+	n, ok := raw.(float64)
+	if !ok || n != math.Trunc(n) {
+		return nil, fmt.Errorf("expected integer, got %v", raw)
+	}
+	min, max := c.bounds(f)
+	if err := checkBounds(n, &min, &max); err != nil {
+		return nil, err
+	}
+	return int64(n), nil
+}
+
+func checkBounds(n float64, min, max *float64) error {
+	if min != nil && n < *min {
+		return fmt.Errorf("%v is less than %v", n, *min)
+	}
+	if max != nil && n > *max {
+		return fmt.Errorf("%v is greater than %v", n, *max)
+	}
+	return nil
+}
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 ()-]{4,19}$`)
+
+// textConverter handles string inputs with a format or a pattern, such as
+// phone numbers, emails and URLs.
+type textConverter struct {
+	format  string
+	pattern *regexp.Regexp
+	check   func(string) error
+}
+
+func (c textConverter) Schema(f *Field) (SchemaProperty, bool, error) {
+	schema := SchemaProperty{
+		Type:        "string",
+		Description: f.Description(),
+		Format:      c.format,
+	}
+	if c.pattern != nil {
+		schema.Pattern = c.pattern.String()
+	}
+	return schema, true, nil
+}
+
+func (c textConverter) FormData(f *Field, raw any) (any, error) {
+	s, ok := raw.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected string, got %T", raw)
+	}
+	if c.pattern != nil && !c.pattern.MatchString(s) {
+		return nil, fmt.Errorf("%q does not match %s", s, c.pattern)
+	}
+	if c.check != nil {
+		if err := c.check(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func checkEmail(s string) error {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return fmt.Errorf("%q is not an email address", s)
+	}
+	return nil
+}
+
+func checkURL(s string) error {
+	u, err := url.ParseRequestURI(s)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute URL", s)
+	}
+	return nil
+}
+
+// tableConverter handles tables: an array of rows whose cells are described
+// by Extra.Columns and converted with their own class converters.
+type tableConverter struct{}
+
+func (tableConverter) Schema(f *Field) (SchemaProperty, bool, error) {
+	if f.Extra == nil || len(f.Extra.Columns) == 0 {
+		return SchemaProperty{}, false, fmt.Errorf("table has no columns")
+	}
+	row := f.conv.rowSchema(f.Section, f.Extra.Columns)
+	schema := SchemaProperty{
+		Type:        "array",
+		Description: f.Description() + ", one item per table row",
+		Items:       &row,
+	}
+	schema.MinItems, schema.MaxItems = itemCounts(f.Content, 0)
+	return schema, true, nil
+}
+
+func (tableConverter) FormData(f *Field, raw any) (any, error) {
+	list, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected array, got %T", raw)
+	}
+	rows := make([]map[string]any, 0, len(list))
+	var errs []error
+	for i, r := range list {
+		cells, ok := r.(map[string]any)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%d: expected object, got %T", i, r))
+			continue
+		}
+		row := make(map[string]any)
+		known := make(map[string]bool)
+		path := fmt.Sprintf("%d/", i)
+		errs = append(errs, f.conv.fillObject(row, known, f.Section, f.Extra.Columns, cells, path)...)
+		errs = append(errs, f.conv.applyItemConditions(f.Section, rowConditional(f.Extra.Columns), row, path)...)
+		errs = append(errs, unknownFields(cells, known, path)...)
+		rows = append(rows, row)
+	}
+	if len(errs) > 0 {
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return nil, errors.New(strings.Join(msgs, "; "))
+	}
+	return rows, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func float(v float64) *float64 { return &v }
+
+func intp(v int) *int { return &v }
+
+func classesForm() Form {
+	return Form{Sections: []Section{{
+		Title: "deal",
+		Content: []Content{
+			{ID: "qty", Class: "number", Title: "Quantity", Required: true, Extra: &Extra{Min: float(1), Precision: intp(0)}},
+			{ID: "price", Class: "currency", Title: "Price", Required: true, Extra: &Extra{Currency: "EUR"}},
+			{ID: "score", Class: "rating", Title: "Score", Required: true},
+			{ID: "mail", Class: "email", Title: "Email", Required: true},
+			{ID: "site", Class: "url", Title: "Site", Required: true},
+			{ID: "tel", Class: "phone", Title: "Phone", Required: true},
+			{ID: "stage", Class: "radio", Title: "Stage", Required: true, Options: []Option{{Title: "Won", Value: "won"}}},
+			{ID: "items", Class: "table", Title: "Items", Required: true, Extra: &Extra{Columns: []Content{
+				{ID: "sku", Class: "edit", Title: "SKU", Required: true},
+				{ID: "count", Class: "number", Title: "Count", Extra: &Extra{Precision: intp(0)}},
+			}}},
+		},
+	}}}
+}
+
+func TestConvertToJSONSchema_Classes(t *testing.T) {
+	root, diagnostics, err := convertToJSONSchema(classesForm(), SchemaOptions{Strict: true})
+	require.NoError(t, err)
+	require.Empty(t, diagnostics)
+
+	bin, err := json.Marshal(root.Properties)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"qty": {"type": "integer", "description": "Section: deal, field: Quantity", "minimum": 1},
+		"price": {"type": "number", "description": "Section: deal, field: Price, amount in EUR"},
+		"score": {"type": "integer", "description": "Section: deal, field: Score", "minimum": 1, "maximum": 5},
+		"mail": {"type": "string", "description": "Section: deal, field: Email", "format": "email"},
+		"site": {"type": "string", "description": "Section: deal, field: Site", "format": "uri"},
+		"tel": {"type": "string", "description": "Section: deal, field: Phone", "pattern": "^\\+?[0-9][0-9 ()-]{4,19}$"},
+		"stage": {"type": "string", "description": "Section: deal, field: Stage", "enum": ["won"], "oneOf": [{"const": "won", "title": "Won"}]},
+		"items": {
+			"type": "array",
+			"description": "Section: deal, field: Items, one item per table row",
+			"minItems": 1,
+			"items": {
+				"type": "object",
+				"additionalProperties": false,
+				"required": ["sku", "count"],
+				"properties": {
+					"sku": {"type": "string", "description": "Section: deal, field: SKU"},
+					"count": {"type": ["integer", "null"], "description": "Section: deal, field: Count, null if not present in the text"}
+				}
+			}
+		}
+	}`, string(bin))
+}
+
+func TestConvertToFormData_Classes(t *testing.T) {
+	data, err := convertToFormData(classesForm(), map[string]any{
+		"qty":   3.0,
+		"price": 10.456,
+		"score": 4.0,
+		"mail":  "a@example.com",
+		"site":  "https://example.com/a",
+		"tel":   "+1 (555) 123-4567",
+		"stage": "won",
+		"items": []any{map[string]any{"sku": "A-1", "count": 2.0}, map[string]any{"sku": "B-2", "count": nil}},
+	}, SchemaOptions{})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), data["qty"])
+	require.Equal(t, 10.46, data["price"])
+	require.Equal(t, int64(4), data["score"])
+	require.Equal(t, []map[string]any{{"value": "won", "title": "Won"}}, data["stage"])
+	require.Equal(t, []map[string]any{{"sku": "A-1", "count": int64(2)}, {"sku": "B-2"}}, data["items"])
+
+	_, err = convertToFormData(classesForm(), map[string]any{
+		"qty":   0.5,
+		"price": 1.0,
+		"score": 6.0,
+		"mail":  "not an email",
+		"site":  "example.com",
+		"tel":   "call me",
+		"stage": "won",
+		"items": []any{map[string]any{"count": 1.0, "color": "red"}},
+	}, SchemaOptions{})
+	require.Error(t, err)
+	for _, msg := range []string{
+		"qty: 0.5 is less than 1",
+		"score: 6 is greater than 5",
+		`mail: "not an email" is not an email address`,
+		`site: "example.com" is not an absolute URL`,
+		`tel: "call me" does not match`,
+		"items: 0/sku: required field is missing",
+		"; 0/color: unknown field",
+	} {
+		require.Contains(t, err.Error(), msg)
+	}
+}
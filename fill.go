@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"graph_maker/aihands"
+	"sort"
+
+	"github.com/openai/openai-go"
+)
+
+const defaultFillSystemMsg = "You fill in forms from text. Only use facts stated in the text. " +
+	"For every field you fill, add an evidence entry with your confidence from 0 to 1 and the exact quote of the text it comes from."
+
+// FillSettings are the model settings of a fill form call.
+type FillSettings struct {
+	APIKey      string
+	Model       string
+	SystemMsg   string
+	Temperature *float64
+	TopP        *float64
+	Seed        *int64
+	MaxTokens   *int64
+	// Chat answers the requests, chatJSON when nil.
+	Chat func(ctx context.Context, req ChatRequest) (string, error)
+}
+
+// fillSettings reads the model settings of a gitcall request.
+func fillSettings(req map[string]any) FillSettings {
+	var settings FillSettings
+	settings.APIKey, _ = req["open_api_key"].(string)
+	settings.Model, _ = req["model"].(string)
+	settings.SystemMsg, _ = req["system_msg"].(string)
+	if temperature, ok := req["temperature"].(float64); ok {
+		settings.Temperature = &temperature
+	}
+	return settings
+}
+
+func (s FillSettings) withDefaults() FillSettings {
+	if s.Model == "" {
+		s.Model = openai.ChatModelGPT4o2024_08_06
+	}
+	if s.SystemMsg == "" {
+		s.SystemMsg = defaultFillSystemMsg
+	}
+	return s
+}
+
+// FieldEvidence backs a filled field with the model's confidence and the
+// quote of the source text it was taken from.
+type FieldEvidence struct {
+	Field      string  `json:"field"`
+	Confidence float64 `json:"confidence"`
+	Quote      string  `json:"quote"`
+}
+
+// FilledField is a filled form value together with its evidence.
+type FilledField struct {
+	Value      any     `json:"value"`
+	Confidence float64 `json:"confidence"`
+	Quote      string  `json:"quote"`
+}
+
+// FillResult is the outcome of filling a form from text.
+type FillResult struct {
+	// Values is the validated answer of the model, merged over all schema parts.
+	Values map[string]any `json:"values"`
+	// Data is Values converted into platform form data.
+	Data   map[string]any         `json:"data"`
+	Fields map[string]FilledField `json:"fields"`
+	Budget BudgetReport           `json:"budget"`
+}
+
+// fillSchema wraps a form schema so the model returns the field values next
+// to the evidence for each of them.
+func fillSchema(values SchemaProperty, nested bool) SchemaProperty {
+	zero, one := 0.0, 1.0
+	evidence := objectSchema()
+	evidence.Properties["field"] = SchemaProperty{Type: "string", Description: "ID of the filled field"}
+	if fields := fieldIDs(values, nested); len(fields) > 0 {
+		evidence.Properties["field"] = SchemaProperty{Type: "string", Description: "ID of the filled field", Enum: &fields}
+	}
+	evidence.Properties["confidence"] = SchemaProperty{Type: "number", Description: "Confidence from 0 to 1", Minimum: &zero, Maximum: &one}
+	evidence.Properties["quote"] = SchemaProperty{Type: "string", Description: "Exact quote of the text the value comes from"}
+	evidence.Required = []string{"field", "confidence", "quote"}
+
+	schema := objectSchema()
+	schema.Properties["values"] = values
+	schema.Properties["evidence"] = SchemaProperty{Type: "array", Description: "One entry per filled field", Items: &evidence}
+	schema.Required = []string{"values", "evidence"}
+	return schema
+}
+
+// fieldIDs lists the form field IDs of a schema, looking into the section
+// objects in NestSections mode.
+func fieldIDs(schema SchemaProperty, nested bool) []string {
+	ids := make([]string, 0, len(schema.Properties))
+	for key, property := range schema.Properties {
+		if !nested {
+			ids = append(ids, key)
+			continue
+		}
+		for id := range property.Properties {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// fillForm asks the model to fill the form from text. Each schema part of a
+// large form is a separate call; the answers are validated, merged and
+// converted into platform form data.
+func fillForm(ctx context.Context, f Form, text string, opts SchemaOptions, settings FillSettings) (FillResult, error) {
+	result := FillResult{Values: make(map[string]any), Fields: make(map[string]FilledField)}
+	parts, report, _, err := fitSchema(f, opts)
+	if err != nil {
+		return result, err
+	}
+	result.Budget = report
+	settings = settings.withDefaults()
+
+	var evidence []FieldEvidence
+	for i, part := range parts {
+		var answer struct {
+			Values   map[string]any  `json:"values"`
+			Evidence []FieldEvidence `json:"evidence"`
+		}
+		schema := fillSchema(part.Schema, opts.NestSections)
+		if err := askFill(ctx, i+1, schema, text, opts, settings, &answer); err != nil {
+			return result, err
+		}
+		mergeValues(result.Values, answer.Values)
+		evidence = append(evidence, answer.Evidence...)
+	}
+
+	result.Data, err = convertToFormData(f, result.Values, opts)
+	if err != nil {
+		return result, err
+	}
+	result.Fields = filledFields(result.Data, evidence)
+	return result, nil
+}
+
+// askFill sends one schema part to the model and decodes the validated and
+// repaired answer into answer.
+func askFill(ctx context.Context, part int, schema SchemaProperty, text string, opts SchemaOptions, settings FillSettings, answer any) error {
+	chat := chatJSON
+	if settings.Chat != nil {
+		chat = settings.Chat
+	}
+	content, err := chat(ctx, ChatRequest{
+		APIKey:      settings.APIKey,
+		Model:       settings.Model,
+		SystemMsg:   settings.SystemMsg,
+		UserMsg:     text,
+		SchemaName:  fmt.Sprintf("fill_form_part_%d", part),
+		Schema:      schema,
+		Strict:      opts.Strict,
+		Temperature: settings.Temperature,
+		TopP:        settings.TopP,
+		Seed:        settings.Seed,
+		MaxTokens:   settings.MaxTokens,
+	})
+	if err != nil {
+		return fmt.Errorf("part %d: %w", part, err)
+	}
+	response, errs, err := checkResponse(schema, content, true)
+	if err != nil {
+		return fmt.Errorf("part %d: %w", part, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("part %d: invalid response: %w", part, joinValidationErrors(errs))
+	}
+	bin, _ := json.Marshal(response)
+	if err := json.Unmarshal(bin, answer); err != nil {
+		return fmt.Errorf("part %d: %w", part, err)
+	}
+	return nil
+}
+
+// filledFields pairs every form data value with its evidence.
+func filledFields(data map[string]any, evidence []FieldEvidence) map[string]FilledField {
+	byField := make(map[string]FieldEvidence, len(evidence))
+	for _, e := range evidence {
+		byField[e.Field] = e
+	}
+	fields := make(map[string]FilledField, len(data))
+	for id, value := range data {
+		e := byField[id]
+		fields[id] = FilledField{Value: value, Confidence: e.Confidence, Quote: e.Quote}
+	}
+	return fields
+}
+
+// mergeValues copies src into dst. Section objects that a split form spread
+// over several parts are merged key by key.
+func mergeValues(dst, src map[string]any) {
+	for key, value := range src {
+		existing, ok1 := dst[key].(map[string]any)
+		incoming, ok2 := value.(map[string]any)
+		if ok1 && ok2 {
+			mergeValues(existing, incoming)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// usercodeFillForm handles fill_form_req: it fills the form from text with
+// the LLM and, when form_id is given, writes the result onto an actor.
+func usercodeFillForm(ctx context.Context, data1 map[string]any, ff map[string]any) error {
+	f, err := parseForm(ff["forms"])
+	if err != nil {
+		return fmt.Errorf("fill_form_req.forms: %w", err)
+	}
+	text, _ := ff["text"].(string)
+	if text == "" {
+		return fmt.Errorf("no fill_form_req.text")
+	}
+	key, _ := ff["open_api_key"].(string)
+	if key == "" {
+		return fmt.Errorf("no fill_form_req.open_api_key")
+	}
+	if simKey, ok := ff["sim_api_key"].(string); ok {
+		aihands.Token = simKey
+	}
+
+	settings := fillSettings(ff)
+
+	if multiple, _ := ff["multiple"].(bool); multiple {
+		return usercodeFillInstances(ctx, data1, ff, f, text, settings)
+	}
+
+	opts, err := schemaOptions(ff)
+	if err != nil {
+		return fmt.Errorf("fill_form_req: %w", err)
+	}
+	result, err := fillForm(ctx, f, text, opts, settings)
+	if err != nil {
+		data1["fill_form_rsp"] = map[string]any{
+			"status": "error",
+			"error":  err.Error(),
+		}
+		return fmt.Errorf("fill form: %w", err)
+	}
+	rsp := map[string]any{
+		"values": result.Values,
+		"data":   result.Data,
+		"fields": result.Fields,
+		"budget": result.Budget,
+		"status": "ok",
+	}
+	writeActor(ff, f, result.Data, rsp)
+	data1["fill_form_rsp"] = rsp
+	return nil
+}
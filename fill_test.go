@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func fakeChat(t *testing.T, answers ...string) *[]ChatRequest {
+	var requests []ChatRequest
+	saved := chatJSON
+	t.Cleanup(func() { chatJSON = saved })
+	chatJSON = func(ctx context.Context, req ChatRequest) (string, error) {
+		requests = append(requests, req)
+		answer := answers[0]
+		answers = answers[1:]
+		return answer, nil
+	}
+	return &requests
+}
+
+func TestFillForm(t *testing.T) {
+	requests := fakeChat(t, `{
+		"values": {"name": "Write report", "done": "true", "due": null, "color": "R"},
+		"evidence": [
+			{"field": "name", "confidence": 0.9, "quote": "write the report"},
+			{"field": "done", "confidence": 0.6, "quote": "already done"}
+		]
+	}`)
+	result, err := fillForm(context.Background(), dataForm(), "Please write the report, it is already done.",
+		SchemaOptions{Strict: true}, fillSettings(map[string]any{"open_api_key": "key-2"}))
+	require.NoError(t, err)
+	require.Len(t, *requests, 1)
+	require.Equal(t, "Please write the report, it is already done.", (*requests)[0].UserMsg)
+	require.Equal(t, "key-2", (*requests)[0].APIKey)
+	require.Equal(t, map[string]any{
+		"name":  "Write report",
+		"done":  true,
+		"color": []map[string]any{{"value": "r", "title": "Red"}},
+	}, result.Data)
+	require.Equal(t, FilledField{Value: "Write report", Confidence: 0.9, Quote: "write the report"}, result.Fields["name"])
+	require.Equal(t, 0.6, result.Fields["done"].Confidence)
+	require.Zero(t, result.Fields["color"].Confidence)
+}
+
+func TestFillForm_InvalidAnswer(t *testing.T) {
+	fakeChat(t, `{"values": {"name": 5}, "evidence": []}`)
+	_, err := fillForm(context.Background(), dataForm(), "text", SchemaOptions{Strict: true}, FillSettings{})
+	require.ErrorContains(t, err, "part 1: invalid response")
+}
+
+func TestFillInstances(t *testing.T) {
+	fakeChat(t, `{"records": [
+		{"values": {"name": "Write report", "done": true, "due": null, "color": null}, "evidence": []},
+		{"values": {"name": "Call Bob", "done": false, "due": null, "color": "r"}, "evidence": []},
+		{"values": {"name": " write  REPORT", "done": false, "due": null, "color": null}, "evidence": []}
+	]}`)
+	f := dataForm()
+	instances, duplicates, err := fillInstances(context.Background(), f, "text", SchemaOptions{Strict: true}, FillSettings{}, "Task", keyFields(f))
+	require.NoError(t, err)
+	require.Equal(t, 1, duplicates)
+	require.Len(t, instances, 2)
+	require.Equal(t, "Task.write report", instances[0].Ref)
+	require.Equal(t, "Task.call bob", instances[1].Ref)
+	require.Equal(t, true, instances[0].Data["done"])
+}
+
+func TestFillInstances_Rerun(t *testing.T) {
+	savedGet, savedUpdate, savedCreate := getActorByRef, updateActor, createActor
+	t.Cleanup(func() { getActorByRef, updateActor, createActor = savedGet, savedUpdate, savedCreate })
+	actors := make(map[string]string)
+	var updated []string
+	getActorByRef = func(formID int, ref string) map[string]any {
+		// The API decodes the path segment before matching the stored ref.
+		ref, err := url.PathUnescape(ref)
+		require.NoError(t, err)
+		if id, ok := actors[ref]; ok {
+			return map[string]any{"data": map[string]any{"id": id}}
+		}
+		return map[string]any{}
+	}
+	updateActor = func(formID int, id, title string, data map[string]any) { updated = append(updated, id) }
+	createActor = func(ref, title string, formID int, data map[string]any) string {
+		actors[ref] = fmt.Sprintf("actor-%d", len(actors)+1)
+		return actors[ref]
+	}
+
+	answer := `{"records": [{"values": {"name": "Write report", "done": true, "due": null, "color": null}, "evidence": []}]}`
+	fakeChat(t, answer, answer)
+	ff := map[string]any{"form_id": 5.0, "strict": true}
+	for run := 0; run < 2; run++ {
+		data := map[string]any{}
+		require.NoError(t, usercodeFillInstances(context.Background(), data, ff, dataForm(), "text", FillSettings{}))
+		records := data["fill_form_rsp"].(map[string]any)["records"].([]FilledInstance)
+		require.Equal(t, "actor-1", records[0].ActorID)
+		require.Equal(t, run == 0, records[0].Created)
+	}
+	require.Equal(t, map[string]string{"Task.write report": "actor-1"}, actors)
+	require.Equal(t, []string{"actor-1"}, updated)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"graph_maker/aihands"
+	"net/url"
+	"sort"
+)
+
+// convertToFormData is the reverse of convertToJSONSchema: it validates the
+// structured output of the model against the form and builds the data
+// payload aihands.CreateActor expects. Empty optional fields are left out,
+// locked fields keep their current value.
+func convertToFormData(f Form, response map[string]any, opts SchemaOptions) (map[string]any, error) {
+	data := make(map[string]any)
+	known := make(map[string]bool)
+	conv := newConversion(opts)
+	var errs []error
+	if opts.NestSections {
+		errs = conv.fillSections(data, known, f.Sections, response)
+	} else {
+		for _, section := range f.Sections {
+			errs = append(errs, conv.fillObject(data, known, section.Title, section.Content, response, "")...)
+		}
+	}
+	errs = append(errs, unknownFields(response, known, "")...)
+	errs = append(errs, conv.applyConditions(f, data)...)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return data, nil
+}
+
+// fillObject converts the model values of items into data and marks their IDs
+// as known. Errors are prefixed with path.
+func (c *conversion) fillObject(data map[string]any, known map[string]bool, section string, items []Content, response map[string]any, path string) []error {
+	var errs []error
+	for _, item := range items {
+		if item.ID == "" || item.hidden() {
+			continue
+		}
+		if item.locked() {
+			data[item.ID] = item.Value
+			continue
+		}
+		converter, ok := fieldConverters[item.Class]
+		if !ok {
+			continue
+		}
+		field := c.field(section, item)
+		if _, ok, err := converter.Schema(field); err != nil || !ok {
+			continue
+		}
+		known[item.ID] = true
+		raw, ok := response[item.ID]
+		if !ok || raw == nil {
+			// Conditional fields are checked by applyConditions.
+			if item.Required && len(item.Conditions) == 0 {
+				errs = append(errs, fmt.Errorf("%s%s: required field is missing", path, item.ID))
+			}
+			continue
+		}
+		value, err := converter.FormData(field, raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s%s: %w", path, item.ID, err))
+			continue
+		}
+		data[item.ID] = value
+	}
+	return errs
+}
+
+// fillSections is fillObject for the nested objects of NestSections mode. The
+// sections are flattened back into one form data map; a field ID filled in
+// more than one section is an error.
+func (c *conversion) fillSections(data map[string]any, known map[string]bool, sections []Section, response map[string]any) []error {
+	var errs []error
+	for i, key := range sectionKeys(sections) {
+		known[key] = true
+		raw, ok := response[key]
+		if !ok || raw == nil {
+			raw = map[string]any{}
+		}
+		nested, ok := raw.(map[string]any)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: expected object, got %T", key, raw))
+			continue
+		}
+		sectionData := make(map[string]any)
+		sectionKnown := make(map[string]bool)
+		path := key + "/"
+		errs = append(errs, c.fillObject(sectionData, sectionKnown, sections[i].Title, sections[i].Content, nested, path)...)
+		errs = append(errs, unknownFields(nested, sectionKnown, path)...)
+		for id, value := range sectionData {
+			if _, ok := data[id]; ok {
+				errs = append(errs, fmt.Errorf("%s%s: field is filled in several sections", path, id))
+				continue
+			}
+			data[id] = value
+		}
+	}
+	return errs
+}
+
+func unknownFields(response map[string]any, known map[string]bool, path string) []error {
+	var unknown []string
+	for key := range response {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	var errs []error
+	for _, key := range unknown {
+		errs = append(errs, fmt.Errorf("%s%s: unknown field", path, key))
+	}
+	return errs
+}
+
+// calendarFormValue builds the platform calendar object. sendInvite is never
+// taken from the model.
+func calendarFormValue(raw any) (map[string]any, error) {
+	obj, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected object, got %T", raw)
+	}
+	value := map[string]any{"sendInvite": false}
+	for _, key := range []string{"startDate", "endDate", "timeZoneOffset"} {
+		n, ok := obj[key].(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected integer, got %T", key, obj[key])
+		}
+		if n != float64(int64(n)) {
+			return nil, fmt.Errorf("%s: expected integer, got %v", key, n)
+		}
+		value[key] = int64(n)
+	}
+	if value["endDate"].(int64) < value["startDate"].(int64) {
+		return nil, fmt.Errorf("endDate is before startDate")
+	}
+	return value, nil
+}
+
+// selectFormValue converts the values chosen by the model into the list of
+// {value, title} objects the platform stores for select and multiSelect fields.
+// Without known options (e.g. an oversized actor filter) the value doubles as title.
+func selectFormValue(options []Option, values []string) ([]map[string]any, error) {
+	titles := make(map[string]string, len(options))
+	for _, option := range options {
+		titles[option.Value] = option.Title
+	}
+	result := make([]map[string]any, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		title, ok := titles[v]
+		if !ok {
+			if len(options) > 0 {
+				return nil, fmt.Errorf("unknown option %q", v)
+			}
+			title = v
+		}
+		result = append(result, map[string]any{
+			"value": v,
+			"title": title,
+		})
+	}
+	return result, nil
+}
+
+// multiSelectValues reads the array the model returns for a multiSelect field.
+func multiSelectValues(raw any) ([]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	list, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected array, got %T", raw)
+	}
+	values := make([]string, 0, len(list))
+	for _, v := range list {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string item, got %T", v)
+		}
+		values = append(values, s)
+	}
+	return values, nil
+}
+
+// Actor calls of upsertActor. Replaced in tests.
+var (
+	getActorByRef = aihands.GetActorByRef
+	updateActor   = aihands.UpdateActor
+	createActor   = func(ref, title string, formID int, data map[string]any) string {
+		return aihands.CreateActor(ref, title, "", formID, data, nil, nil, "")
+	}
+)
+
+// upsertActor writes form data onto an actor. An explicit actorID is updated,
+// otherwise the actor with the given ref is updated or created. The ref is
+// stored as is; the lookup escapes it as a path segment, which the API
+// decodes back into the stored ref.
+func upsertActor(formID int, actorID, ref, title string, data map[string]any) (string, bool) {
+	if actorID == "" && ref != "" {
+		rsp := getActorByRef(formID, url.PathEscape(ref))
+		if actor, ok := rsp["data"].(map[string]any); ok {
+			actorID, _ = actor["id"].(string)
+		}
+	}
+	if actorID != "" {
+		updateActor(formID, actorID, title, data)
+		return actorID, false
+	}
+	return createActor(ref, title, formID, data), true
+}
+
+// writeActor writes data onto an actor when the request has a form_id, see
+// upsertActor, and reports the actor in rsp.
+func writeActor(req map[string]any, f Form, data map[string]any, rsp map[string]any) {
+	formID, ok := req["form_id"].(float64)
+	if !ok {
+		return
+	}
+	actorID, _ := req["actor_id"].(string)
+	ref, _ := req["ref"].(string)
+	title, _ := req["title"].(string)
+	if actorID == "" && title == "" {
+		title = f.Title
+	}
+	id, created := upsertActor(int(formID), actorID, ref, title, data)
+	rsp["actor_id"] = id
+	rsp["created"] = created
+}
+
+// usercodeFormData handles form_data_req: it turns a model response into
+// platform form data and, when form_id is given, writes it onto an actor.
+func usercodeFormData(ctx context.Context, data1 map[string]any, fd map[string]any) error {
+	f, err := parseForm(fd["forms"])
+	if err != nil {
+		return fmt.Errorf("form_data_req.forms: %w", err)
+	}
+
+	if fd["response"] == nil {
+		return fmt.Errorf("no form_data_req.response")
+	}
+	if key, ok := fd["sim_api_key"].(string); ok {
+		aihands.Token = key
+	}
+	opts, err := schemaOptions(fd)
+	if err != nil {
+		return fmt.Errorf("form_data_req: %w", err)
+	}
+	repair, _ := fd["repair"].(bool)
+
+	schema, _, err := convertToJSONSchema(f, opts)
+	if err != nil {
+		return fmt.Errorf("error converting to JSON Schema: %w", err)
+	}
+	checked, errs, err := checkResponse(schema, fd["response"], repair)
+	if err != nil {
+		return fmt.Errorf("error reading response: %w", err)
+	}
+	if len(errs) > 0 {
+		data1["form_data_rsp"] = map[string]any{
+			"status": "error",
+			"errors": errs,
+		}
+		return fmt.Errorf("invalid response: %w", joinValidationErrors(errs))
+	}
+	response, ok := checked.(map[string]any)
+	if !ok {
+		return fmt.Errorf("form_data_req.response is not an object")
+	}
+
+	formData, err := convertToFormData(f, response, opts)
+	if err != nil {
+		data1["form_data_rsp"] = map[string]any{
+			"status": "error",
+			"error":  err.Error(),
+		}
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	rsp := map[string]any{
+		"data":   formData,
+		"status": "ok",
+	}
+
+	writeActor(fd, f, formData, rsp)
+	data1["form_data_rsp"] = rsp
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func dataForm() Form {
+	return Form{Title: "Task", Sections: []Section{{
+		Title: "main",
+		Content: []Content{
+			{ID: "name", Class: "edit", Title: "Name", Required: true},
+			{ID: "done", Class: "check", Title: "Done"},
+			{ID: "due", Class: "calendar", Title: "Due"},
+			{ID: "color", Class: "select", Title: "Color", Options: []Option{{Title: "Red", Value: "r"}}},
+			{ID: "file", Class: "upload", Title: "File"},
+		},
+	}}}
+}
+
+func TestConvertToFormData(t *testing.T) {
+	data, err := convertToFormData(dataForm(), map[string]any{
+		"name":  "Write report",
+		"done":  true,
+		"due":   map[string]any{"startDate": 1700000000.0, "endDate": 1700003600.0, "timeZoneOffset": 120.0, "sendInvite": true},
+		"color": nil,
+	}, SchemaOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"name": "Write report",
+		"done": true,
+		"due": map[string]any{
+			"startDate":      int64(1700000000),
+			"endDate":        int64(1700003600),
+			"timeZoneOffset": int64(120),
+			"sendInvite":     false,
+		},
+	}, data)
+}
+
+func TestConvertToFormData_Invalid(t *testing.T) {
+	_, err := convertToFormData(dataForm(), map[string]any{
+		"done":  "yes",
+		"color": "g",
+		"extra": 1.0,
+	}, SchemaOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "name: required field is missing")
+	require.Contains(t, err.Error(), "done: expected boolean")
+	require.Contains(t, err.Error(), `color: unknown option "g"`)
+	require.Contains(t, err.Error(), "extra: unknown field")
+}
+
+func TestUserCode_FormData(t *testing.T) {
+	data := map[string]any{
+		"form_data_req": map[string]any{
+			"forms": map[string]any{
+				"title": "Task",
+				"sections": []any{map[string]any{
+					"title":   "main",
+					"content": []any{map[string]any{"id": "color", "class": "select", "title": "Color", "options": []any{map[string]any{"title": "Red", "value": "r"}}}},
+				}},
+			},
+			"response": `{"color": "r"}`,
+		},
+	}
+	err := usercode(context.Background(), data)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"data":   map[string]any{"color": []map[string]any{{"value": "r", "title": "Red"}}},
+		"status": "ok",
+	}, data["form_data_rsp"])
+}
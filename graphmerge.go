@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+const (
+	// nodeGap is the distance kept between the nodes of different chunks.
+	nodeGap = 3
+	// graphModel extracts the graph unless the request picks another model.
+	graphModel = openai.ChatModelGPT4o2024_08_06
+	// defaultChunkOverlap is the number of tokens a chunk repeats of the one
+	// before it, so entities cut at a chunk boundary are seen whole.
+	defaultChunkOverlap = 200
+)
+
+// Extraction is the merged graph of a text with the chunks it was extracted
+// from. Sources lists the chunk indexes every node was found in, Forms the
+// form every node's actor goes to.
+type Extraction struct {
+	Graph   Graph
+	Chunks  []Chunk
+	Sources map[string][]int
+	Forms   map[string]NodeForm
+	// ClassifyErrors are the classification failures, see classifyNodes.
+	ClassifyErrors []ClassifyError
+}
+
+var (
+	nonWordChars = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+	articles     = map[string]bool{"the": true, "a": true, "an": true}
+)
+
+// extractGraph asks extractor for the graph of every chunk and merges the
+// partial graphs. Each chunk after the first is told the entity names found
+// so far, so the model reuses them for the same entities.
+func extractGraph(ctx context.Context, extractor GraphExtractor, schema SchemaProperty, systemMsg string, chunks []Chunk) (Extraction, error) {
+	var graphs []Graph
+	var names []string
+	seen := make(map[string]bool)
+	for i, chunk := range chunks {
+		msg := chunk.Text
+		if len(names) > 0 {
+			msg = "Entities already extracted from earlier parts of the text: " + strings.Join(names, "; ") +
+				". Reuse these exact names when the same entity appears.\n\n" + chunk.Text
+		}
+		graph, err := extractor.ExtractGraph(ctx, schema, systemMsg, msg)
+		if err != nil {
+			return Extraction{}, fmt.Errorf("chunk %d (bytes %d-%d): %w", i+1, chunk.Offset, chunk.End, err)
+		}
+		graphs = append(graphs, graph)
+		for _, n := range graph.Nodes {
+			if key := entityKey(n.Name); !seen[key] {
+				seen[key] = true
+				names = append(names, n.Name)
+			}
+		}
+	}
+	graph, sources := mergeGraphs(graphs)
+	return Extraction{Graph: graph, Chunks: chunks, Sources: sources}, nil
+}
+
+// entityKey is the name under which nodes are resolved into one entity:
+// case, punctuation and leading articles are ignored.
+func entityKey(name string) string {
+	words := strings.Fields(nonWordChars.ReplaceAllString(strings.ToLower(name), " "))
+	if len(words) > 1 && articles[words[0]] {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// mergeGraphs merges the graphs of consecutive chunks. Node IDs are only
+// unique within a chunk, so every node gets a new ID; nodes with the same
+// entityKey become one node, keeping the first name and position; later
+// chunks fill in its type and description if missing and add attributes it
+// does not have yet. Edges are remapped to the new IDs, and the duplicates
+// (same endpoints and label) and self-loops that merging produces are
+// dropped, as are edges to nodes the chunk does not have. The
+// new nodes of a chunk are placed to the right of the nodes before them.
+// The sources map lists the indexes of the graphs each merged node is in.
+func mergeGraphs(graphs []Graph) (Graph, map[string][]int) {
+	merged := Graph{Nodes: make([]Node, 0), Edges: make([]Edge, 0)}
+	sources := make(map[string][]int)
+	byKey := make(map[string]string)
+	type edgeKey struct{ source, target, label string }
+	edges := make(map[edgeKey]bool)
+	maxX := 0
+	for i, graph := range graphs {
+		ids := make(map[string]string, len(graph.Nodes))
+		var added []Node
+		for _, n := range graph.Nodes {
+			key := entityKey(n.Name)
+			if id, ok := byKey[key]; ok {
+				ids[n.ID] = id
+				pos, _ := strconv.Atoi(id)
+				if pos--; pos < len(merged.Nodes) {
+					mergeNode(&merged.Nodes[pos], n)
+				} else {
+					mergeNode(&added[pos-len(merged.Nodes)], n)
+				}
+				if s := sources[id]; s[len(s)-1] != i {
+					sources[id] = append(s, i)
+				}
+				continue
+			}
+			id := strconv.Itoa(len(merged.Nodes) + len(added) + 1)
+			byKey[key], ids[n.ID] = id, id
+			sources[id] = []int{i}
+			n.ID = id
+			added = append(added, n)
+		}
+
+		if len(merged.Nodes) > 0 && len(added) > 0 {
+			minX := added[0].X
+			for _, n := range added {
+				minX = minInt(minX, n.X)
+			}
+			for i := range added {
+				added[i].X += maxX - minX + nodeGap
+			}
+		}
+		for _, n := range added {
+			if len(merged.Nodes) == 0 || n.X > maxX {
+				maxX = n.X
+			}
+			merged.Nodes = append(merged.Nodes, n)
+		}
+
+		for _, e := range graph.Edges {
+			source, ok1 := ids[e.Source]
+			target, ok2 := ids[e.Target]
+			key := edgeKey{source, target, strings.ToLower(strings.TrimSpace(e.Label))}
+			if !ok1 || !ok2 || source == target || edges[key] {
+				continue
+			}
+			edges[key] = true
+			e.Source, e.Target = source, target
+			merged.Edges = append(merged.Edges, e)
+		}
+	}
+	return merged, sources
+}
+
+// mergeNode adds what n says about the entity of node.
+func mergeNode(node *Node, n Node) {
+	if node.Type == "" {
+		node.Type = n.Type
+	}
+	if node.Description == "" {
+		node.Description = n.Description
+	}
+	for _, a := range n.Attributes {
+		known := false
+		for _, b := range node.Attributes {
+			if strings.EqualFold(a.Key, b.Key) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			node.Attributes = append(node.Attributes, a)
+		}
+	}
+}
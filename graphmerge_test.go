@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeGraphs(t *testing.T) {
+	merged, sources := mergeGraphs([]Graph{{
+		Nodes: []Node{{ID: "1", Name: "Acme Corp", X: 0}, {ID: "2", Name: "Bob", X: 3}},
+		Edges: []Edge{{Source: "1", Target: "2"}},
+	}, {
+		Nodes: []Node{{ID: "1", Name: "Bob", X: -3}, {ID: "2", Name: "the acme corp.", X: 0}, {ID: "3", Name: "Alice", X: 0}},
+		Edges: []Edge{
+			{Source: "2", Target: "1"},
+			{Source: "1", Target: "3"},
+			{Source: "2", Target: "2"},
+			{Source: "3", Target: "9"},
+		},
+	}})
+	require.Equal(t, []Node{
+		{ID: "1", Name: "Acme Corp", X: 0},
+		{ID: "2", Name: "Bob", X: 3},
+		{ID: "3", Name: "Alice", X: 6},
+	}, merged.Nodes)
+	require.Equal(t, []Edge{{Source: "1", Target: "2"}, {Source: "2", Target: "3"}}, merged.Edges)
+	require.Equal(t, map[string][]int{"1": {0, 1}, "2": {0, 1}, "3": {1}}, sources)
+}
+
+func TestMergeGraphs_Details(t *testing.T) {
+	merged, _ := mergeGraphs([]Graph{{
+		Nodes: []Node{{ID: "1", Name: "Acme", Type: "organization", Attributes: []Attribute{{Key: "city", Value: "Kyiv"}}},
+			{ID: "2", Name: "Bob"}},
+		Edges: []Edge{{Source: "2", Target: "1", Label: "works for", Directed: true, Weight: 0.8}},
+	}, {
+		Nodes: []Node{{ID: "1", Name: "Acme", Type: "company", Description: "A maker of anvils.",
+			Attributes: []Attribute{{Key: "City", Value: "Lviv"}, {Key: "founded", Value: "1949"}}}, {ID: "2", Name: "Bob"}},
+		Edges: []Edge{
+			{Source: "2", Target: "1", Label: "Works for", Directed: true, Weight: 0.5},
+			{Source: "2", Target: "1", Label: "owns shares of", Directed: true, Weight: 0.3},
+		},
+	}})
+	require.Equal(t, Node{ID: "1", Name: "Acme", Type: "organization", Description: "A maker of anvils.",
+		Attributes: []Attribute{{Key: "city", Value: "Kyiv"}, {Key: "founded", Value: "1949"}}}, merged.Nodes[0])
+	require.Equal(t, []Edge{
+		{Source: "2", Target: "1", Label: "works for", Directed: true, Weight: 0.8},
+		{Source: "2", Target: "1", Label: "owns shares of", Directed: true, Weight: 0.3},
+	}, merged.Edges)
+}
+
+func TestNodeFormData(t *testing.T) {
+	n := Node{Type: "person", Attributes: []Attribute{{Key: "role", Value: "CEO"}, {Key: "age", Value: "42"}}}
+	require.Equal(t, map[string]any{"type": "person", "attributes": "role: CEO\nage: 42"}, nodeFormData(n, graphMakerSections))
+	require.Equal(t, map[string]any{"type": "person"}, nodeFormData(n, []Section{{Content: []Content{{ID: "type", Class: "edit"}}}}))
+	require.Equal(t, map[string]any{"type": "employment", "relationship": "works for", "directed": true, "weight": 0.8},
+		edgeLinkData(Edge{Type: "employment", Label: "works for", Directed: true, Weight: 0.8}))
+}
+
+func TestExtractGraph(t *testing.T) {
+	extractor := &scriptedExtractor{graphs: []Graph{{
+		Nodes: []Node{{ID: "a", Name: "Acme"}},
+	}, {
+		Nodes: []Node{{ID: "a", Name: "Bob"}, {ID: "b", Name: "ACME", X: 3}},
+		Edges: []Edge{{Source: "b", Target: "a"}},
+	}}}
+	extraction, err := extractGraph(context.Background(), extractor, graphSchema, "graph",
+		[]Chunk{{Text: "Acme hires.", End: 11}, {Text: "Bob joins Acme.", Offset: 12, End: 27}})
+	require.NoError(t, err)
+	graph := extraction.Graph
+	require.Equal(t, []string{"Acme hires.", "Entities already extracted from earlier parts of the text: Acme. " +
+		"Reuse these exact names when the same entity appears.\n\nBob joins Acme."}, extractor.texts)
+	require.Equal(t, []Node{{ID: "1", Name: "Acme"}, {ID: "2", Name: "Bob", X: 3}}, graph.Nodes)
+	require.Equal(t, []Edge{{Source: "1", Target: "2"}}, graph.Edges)
+	require.Equal(t, map[string][]int{"1": {0, 1}, "2": {1}}, extraction.Sources)
+
+	_, err = extractGraph(context.Background(), &scriptedExtractor{}, graphSchema, "graph", []Chunk{{Text: "Acme hires.", End: 11}})
+	require.EqualError(t, err, "chunk 1 (bytes 0-11): unexpected extraction 1")
+}
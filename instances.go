@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FilledInstance is one form instance found in the text in multiple mode.
+type FilledInstance struct {
+	Values  map[string]any         `json:"values"`
+	Data    map[string]any         `json:"data"`
+	Fields  map[string]FilledField `json:"fields"`
+	Ref     string                 `json:"ref"`
+	ActorID string                 `json:"actor_id,omitempty"`
+	Created bool                   `json:"created,omitempty"`
+}
+
+// instancesSchema asks for every instance of the form described in the text.
+func instancesSchema(values SchemaProperty, nested bool) SchemaProperty {
+	record := fillSchema(values, nested)
+	schema := objectSchema()
+	schema.Properties["records"] = SchemaProperty{
+		Type:        "array",
+		Description: "One entry per instance of the form described in the text",
+		Items:       &record,
+	}
+	schema.Required = []string{"records"}
+	return schema
+}
+
+// fillInstances extracts all instances of the form from text. Instances with
+// the same ref are the same record mentioned twice: only the first is kept.
+func fillInstances(ctx context.Context, f Form, text string, opts SchemaOptions, settings FillSettings, prefix string, keys []string) ([]FilledInstance, int, error) {
+	parts, _, _, err := fitSchema(f, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Records of different parts could not be matched with each other.
+	if len(parts) > 1 {
+		return nil, 0, fmt.Errorf("form needs %d schemas to fit the limits, multiple mode supports one", len(parts))
+	}
+	var answer struct {
+		Records []struct {
+			Values   map[string]any  `json:"values"`
+			Evidence []FieldEvidence `json:"evidence"`
+		} `json:"records"`
+	}
+	schema := instancesSchema(parts[0].Schema, opts.NestSections)
+	if err := askFill(ctx, 1, schema, text, opts, settings.withDefaults(), &answer); err != nil {
+		return nil, 0, err
+	}
+
+	instances := make([]FilledInstance, 0, len(answer.Records))
+	seen := make(map[string]bool)
+	duplicates := 0
+	var errs []error
+	for i, record := range answer.Records {
+		data, err := convertToFormData(f, record.Values, opts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("record %d: %w", i, err))
+			continue
+		}
+		ref := instanceRef(prefix, data, keys)
+		if ref != "" && seen[ref] {
+			duplicates++
+			continue
+		}
+		seen[ref] = true
+		instances = append(instances, FilledInstance{
+			Values: record.Values,
+			Data:   data,
+			Fields: filledFields(data, record.Evidence),
+			Ref:    ref,
+		})
+	}
+	if len(errs) > 0 {
+		return instances, duplicates, errors.Join(errs...)
+	}
+	return instances, duplicates, nil
+}
+
+// keyFields are the fields that identify an instance when the request does
+// not name them: the required text fields, or else the first text field.
+func keyFields(f Form) []string {
+	var required, text []string
+	for _, section := range f.Sections {
+		for _, item := range section.Content {
+			if item.Class != "edit" || item.hidden() {
+				continue
+			}
+			text = append(text, item.ID)
+			if item.Required {
+				required = append(required, item.ID)
+			}
+		}
+	}
+	if len(required) > 0 {
+		return required
+	}
+	if len(text) > 0 {
+		return text[:1]
+	}
+	return nil
+}
+
+// instanceRef builds the actor ref of an instance from its key fields,
+// prefixed like the node refs of makeGraph. Values are normalised so that
+// re-runs on a slightly different text still find the actor. An instance
+// without key values gets no ref and always creates a new actor.
+func instanceRef(prefix string, data map[string]any, keys []string) string {
+	values := make([]string, 0, len(keys))
+	empty := true
+	for _, key := range keys {
+		value := ""
+		if v, ok := data[key]; ok && v != nil {
+			value = strings.ToLower(strings.Join(strings.Fields(fmt.Sprint(v)), " "))
+		}
+		if value != "" {
+			empty = false
+		}
+		values = append(values, value)
+	}
+	if empty {
+		return ""
+	}
+	return prefix + "." + strings.Join(values, "|")
+}
+
+// usercodeFillInstances handles fill_form_req with multiple set: every
+// instance found in the text is returned and, when form_id is given, written
+// onto its own actor.
+func usercodeFillInstances(ctx context.Context, data1 map[string]any, ff map[string]any, f Form, text string, settings FillSettings) error {
+	prefix, _ := ff["ref"].(string)
+	if prefix == "" {
+		prefix = f.Title
+	}
+	keys := keyFields(f)
+	if list, ok := ff["key_fields"].([]any); ok {
+		keys = nil
+		for _, key := range list {
+			if id, ok := key.(string); ok {
+				keys = append(keys, id)
+			}
+		}
+	}
+
+	opts, err := schemaOptions(ff)
+	if err != nil {
+		return fmt.Errorf("fill_form_req: %w", err)
+	}
+	instances, duplicates, err := fillInstances(ctx, f, text, opts, settings, prefix, keys)
+	if err != nil && len(instances) == 0 {
+		data1["fill_form_rsp"] = map[string]any{
+			"status": "error",
+			"error":  err.Error(),
+		}
+		return fmt.Errorf("fill form: %w", err)
+	}
+	if formID, ok := ff["form_id"].(float64); ok {
+		for i, instance := range instances {
+			title := f.Title
+			if len(keys) > 0 {
+				if v, ok := instance.Data[keys[0]].(string); ok && v != "" {
+					title = v
+				}
+			}
+			// upsertActor looks the ref up first, so re-runs update the actors.
+			instances[i].ActorID, instances[i].Created = upsertActor(int(formID), "", instance.Ref, title, instance.Data)
+		}
+	}
+	rsp := map[string]any{
+		"records":    instances,
+		"duplicates": duplicates,
+		"status":     "ok",
+	}
+	if err != nil {
+		rsp["status"] = "partial"
+		rsp["error"] = err.Error()
+	}
+	data1["fill_form_rsp"] = rsp
+	return nil
+}
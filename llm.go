@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// ChatRequest is one structured output exchange with the LLM.
+type ChatRequest struct {
+	// APIKey is the OpenAI key of the request a client is built for.
+	APIKey      string
+	Model       string
+	SystemMsg   string
+	UserMsg     string
+	SchemaName  string
+	Schema      any
+	Strict      bool
+	Temperature *float64
+	TopP        *float64
+	Seed        *int64
+	MaxTokens   *int64
+}
+
+// chatJSON queries the Chat Completions API with a JSON schema response
+// format and returns the JSON the model answered with. Every request gets a
+// client of its own, so each call uses the key it was given. Replaced in tests.
+var chatJSON = func(ctx context.Context, req ChatRequest) (string, error) {
+	return chatCompletion(ctx, openai.NewClient(option.WithAPIKey(req.APIKey)), req)
+}
+
+// chatCompletion is chatJSON against the API c is configured for. The schema
+// is sent the way strict mode takes it, see adaptOpenAI; answers are still
+// validated against req.Schema by the callers.
+func chatCompletion(ctx context.Context, c *openai.Client, req ChatRequest) (string, error) {
+	schema, err := openAISchema(req.Schema)
+	if err != nil {
+		return "", fmt.Errorf("schema: %w", err)
+	}
+	schemaParam := openai.ResponseFormatJSONSchemaJSONSchemaParam{
+		Name:        openai.F(req.SchemaName),
+		Description: openai.F("The structured output of the model"),
+		Schema:      openai.F[any](schema),
+		Strict:      openai.Bool(req.Strict),
+	}
+	params := openai.ChatCompletionNewParams{
+		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(req.SystemMsg),
+			openai.UserMessage(req.UserMsg),
+		}),
+		ResponseFormat: openai.F[openai.ChatCompletionNewParamsResponseFormatUnion](
+			openai.ResponseFormatJSONSchemaParam{
+				Type:       openai.F(openai.ResponseFormatJSONSchemaTypeJSONSchema),
+				JSONSchema: openai.F(schemaParam),
+			},
+		),
+		// Only certain models can perform structured outputs
+		Model: openai.F(req.Model),
+	}
+	if req.Temperature != nil {
+		params.Temperature = openai.F(*req.Temperature)
+	}
+	if req.TopP != nil {
+		params.TopP = openai.F(*req.TopP)
+	}
+	if req.Seed != nil {
+		params.Seed = openai.F(*req.Seed)
+	}
+	if req.MaxTokens != nil {
+		params.MaxTokens = openai.F(*req.MaxTokens)
+	}
+
+	// Query the Chat Completions API
+	chat, err := c.Chat.Completions.New(ctx, params)
+	if err != nil {
+		return "", err
+	}
+	if len(chat.Choices) == 0 {
+		return "", fmt.Errorf("no choices in chat completion")
+	}
+	return chat.Choices[0].Message.Content, nil
+}
+
+// openAISchema is schema with the keywords OpenAI strict mode rejects
+// rewritten by adaptOpenAI.
+func openAISchema(schema any) (map[string]any, error) {
+	bin, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	var node map[string]any
+	if err := json.Unmarshal(bin, &node); err != nil {
+		return nil, err
+	}
+	return adaptOpenAI(node), nil
+}
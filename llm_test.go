@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatCompletion_AdaptsSchema(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": "1", "object": "chat.completion", "model": "gpt-4o", "choices": [
+			{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "{}"}}]}`))
+	}))
+	defer server.Close()
+
+	form := Form{Title: "Order", Sections: []Section{{
+		Title: "main",
+		Content: []Content{
+			{ID: "color", Class: "select", Title: "Color", Required: true,
+				Options: []Option{{Title: "Red", Value: "R"}, {Title: "Green", Value: "G"}}},
+			{ID: "tags", Class: "multiSelect", Title: "Tags", Options: []Option{{Title: "Gift", Value: "gift"}}},
+			{ID: "site", Class: "url", Title: "Site"},
+			{ID: "note", Class: "edit", Title: "Note",
+				Conditions: []Condition{{Field: "color", Values: []string{"R"}}}},
+		},
+	}}}
+	schema, _, err := convertToJSONSchema(form, SchemaOptions{Strict: true, Conditions: ConditionsIfThenElse})
+	require.NoError(t, err)
+	require.NotNil(t, schema.AllOf)
+
+	client := openai.NewClient(option.WithBaseURL(server.URL), option.WithAPIKey("key"), option.WithMaxRetries(0))
+	content, err := chatCompletion(context.Background(), client, ChatRequest{Model: "gpt-4o", SchemaName: "fill_form", Schema: schema, Strict: true})
+	require.NoError(t, err)
+	require.Equal(t, "{}", content)
+
+	sent := body["response_format"].(map[string]any)["json_schema"].(map[string]any)["schema"].(map[string]any)
+	require.NotContains(t, sent, "allOf")
+	properties := sent["properties"].(map[string]any)
+	color := properties["color"].(map[string]any)
+	require.NotContains(t, color, "oneOf")
+	require.Equal(t, "Section: main, field: Color, options: R = Red; G = Green", color["description"])
+	require.NotContains(t, properties["tags"], "uniqueItems")
+	require.NotContains(t, properties["site"], "format")
+
+	// The caller's schema is left as it was for validation.
+	require.NotNil(t, schema.AllOf)
+	require.NotEmpty(t, schema.Properties["color"].OneOf)
+}
@@ -6,21 +6,16 @@ import (
 	"fmt"
 	"github.com/corezoid/gitcall-go-runner/gitcall"
 	"github.com/invopop/jsonschema"
-	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/option"
 	"graph_maker/aihands"
 	"net/url"
+	"os"
 	"runtime"
 	"strconv"
 	"strings"
-	"sync"
 )
 
 import _ "embed" //do not delete
 
-var once sync.Once
-var client *openai.Client
-
 // Generate the JSON schema at initialization time
 var Schema = GenerateSchema[Graph]()
 
@@ -30,14 +25,25 @@ type Graph struct {
 	Edges []Edge `json:"edges" jsonschema_description:"The edges in the graph"`
 }
 type Node struct {
-	ID   string `json:"id" jsonschema_description:"The unique identifier of the node"`
-	Name string `json:"name" jsonschema_description:"The name of the node"`
-	X    int    `json:"x" jsonschema_description:"The x-coordinate of the node, tree view of graph, the distance between actors must be no less than 3, 0 - center"`
-	Y    int    `json:"y" jsonschema_description:"The y-coordinate of the node, tree view of graph, the distance between actors must be no less than 3, 0 - center"`
+	ID          string      `json:"id" jsonschema_description:"The unique identifier of the node"`
+	Name        string      `json:"name" jsonschema_description:"The name of the node"`
+	Type        string      `json:"type" jsonschema_description:"The kind of thing the node is, e.g. person, organization, place, event or concept"`
+	Description string      `json:"description" jsonschema_description:"What the text says about the node, in one or two sentences"`
+	Attributes  []Attribute `json:"attributes" jsonschema_description:"Facts about the node stated in the text, e.g. role, date or amount"`
+	X           int         `json:"x" jsonschema_description:"The x-coordinate of the node, tree view of graph, the distance between actors must be no less than 3, 0 - center"`
+	Y           int         `json:"y" jsonschema_description:"The y-coordinate of the node, tree view of graph, the distance between actors must be no less than 3, 0 - center"`
+}
+type Attribute struct {
+	Key   string `json:"key" jsonschema_description:"The name of the attribute"`
+	Value string `json:"value" jsonschema_description:"The value of the attribute"`
 }
 type Edge struct {
-	Source string `json:"source" jsonschema_description:"The source node of the edge"`
-	Target string `json:"target" jsonschema_description:"The target node of the edge"`
+	Source   string  `json:"source" jsonschema_description:"The source node of the edge"`
+	Target   string  `json:"target" jsonschema_description:"The target node of the edge"`
+	Type     string  `json:"type" jsonschema_description:"The edge type of the relationship"`
+	Label    string  `json:"label" jsonschema_description:"The relationship from source to target as a short verb phrase, e.g. works for"`
+	Directed bool    `json:"directed" jsonschema_description:"Whether the relationship goes from source to target only, false when it holds both ways"`
+	Weight   float64 `json:"weight" jsonschema_description:"The strength of the relationship from 0 (weak) to 1 (strong)"`
 }
 
 func GenerateSchema[T any]() interface{} {
@@ -53,6 +59,9 @@ func GenerateSchema[T any]() interface{} {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "gen" {
+		os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
+	}
 	gitcall.Handle(usercode)
 }
 
@@ -61,177 +70,45 @@ type Request struct {
 	GraphFormID  int
 	LayerFormID  int
 	LinkType     int
+	EdgeTypes    map[string]int
 	FormID       int
+	// FormSections are the sections of the catch-all form FormID. Forms
+	// created before nodes got type and attributes fields have none.
+	FormSections []Section
 	Ref          string
 	OpenAPIKey   string
+	Provider     string
+	BaseURL      string
+	APIKey       string
+	Params       GraphParams
 	SystemMsg    string
 	UserMsg      string
-	ChunkSize    int
-	Users        []int
-	SimAPIKey    string
-	WorkspaceID  string
-}
-
-type Section struct {
-	Title   string    `json:"title"`
-	Content []Content `json:"content"`
-}
-
-type ExtraValue struct {
-	ID string `json:"id"`
-}
-type ExtraOptionsSource struct {
-	Type  string     `json:"type"`
-	Value ExtraValue `json:"value"`
-}
-type Extra struct {
-	OptionsSource *ExtraOptionsSource `json:"optionsSource,omitempty"`
-}
-
-type Form struct {
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Sections    []Section `json:"sections"`
-}
-
-// Content представляет структуру входного JSON элемента
-type Content struct {
-	ID           string      `json:"id"`
-	Class        string      `json:"class"`
-	Title        string      `json:"title"`
-	Value        interface{} `json:"value,omitempty"`
-	Options      []Option    `json:"options,omitempty"`
-	Visibility   string      `json:"visibility,omitempty"`
-	Key          string      `json:"key,omitempty"`
-	IDNotChanged bool        `json:"idNotChanged,omitempty"`
-	Required     bool        `json:"required,omitempty"`
-	Extra        *Extra      `json:"extra,omitempty"`
-}
-
-// Option представляет структуру опции
-type Option struct {
-	Title string `json:"title"`
-	Value string `json:"value"`
-}
-
-type OneOf struct {
-	Const string `json:"const"`
-	Title string `json:"title"`
-}
-
-// SchemaProperty представляет свойство JSON Schema
-type SchemaProperty struct {
-	Type        string                    `json:"type"`
-	Description string                    `json:"description,omitempty"`
-	Properties  map[string]SchemaProperty `json:"properties,omitempty"`
-	Required    []string                  `json:"required,omitempty"`
-	Enum        *[]string                 `json:"enum,omitempty"`
-	OneOf       *[]OneOf                  `json:"oneOf,omitempty"`
-}
-
-func convertToJSONSchema(f Form) (map[string]SchemaProperty, error) {
-	properties := make(map[string]SchemaProperty)
-	for _, section := range f.Sections {
-		sectionTitle := section.Title
-		for _, item := range section.Content {
-			var schema SchemaProperty
-			if item.Visibility == "disabled" {
-				continue
-			}
-			switch {
-			case item.Class == "edit":
-				schema = SchemaProperty{
-					Type:        "string",
-					Description: "Section: " + sectionTitle + ", field: " + item.Title,
-				}
-
-			case item.Class == "calendar":
-				schema = SchemaProperty{
-					Type: "object",
-					Properties: map[string]SchemaProperty{
-						"startDate": {
-							Type:        "integer",
-							Description: "Date and time in unixtime",
-						},
-						"endDate": {
-							Type:        "integer",
-							Description: "Date and time in unixtime",
-						},
-						"timeZoneOffset": {
-							Type:        "integer",
-							Description: "time Zone Offset",
-						},
-						"sendInvite": {
-							Type:        "boolean",
-							Description: "always false",
-						},
-					},
-					Required: []string{
-						"startDate",
-						"endDate",
-						"timeZoneOffset",
-						"sendInvite",
-					},
-				}
-			case item.Class == "select" || item.Class == "multiSelect":
-				var oneOf1 *[]OneOf
-				var enum1 *[]string
-				if item.Options != nil && len(item.Options) > 0 {
-					enum := make([]string, 0, len(item.Options))
-					oneOf := make([]OneOf, 0, len(item.Options))
-					for _, option := range item.Options {
-						enum = append(enum, option.Value)
-						oneOf = append(oneOf, OneOf{
-							Const: option.Value,
-							Title: option.Title,
-						})
-					}
-					if len(enum) > 0 {
-						enum1 = &enum
-					}
-					if len(oneOf) > 0 {
-						oneOf1 = &oneOf
-					}
-				} else if item.Extra != nil && item.Extra.OptionsSource != nil {
-					switch item.Extra.OptionsSource.Type {
-					case "actorFilter":
-						if item.Extra.OptionsSource.Value.ID != "" {
-
-						}
-					default:
-						panic(fmt.Sprintf("Unknown extra options source type: %s", item.Extra.OptionsSource.Type))
-					}
-
-				}
-
-				schema = SchemaProperty{
-					Type:        "string",
-					Description: "Section: " + sectionTitle + ", field: " + item.Title,
-					Enum:        enum1,
-					OneOf:       oneOf1,
-				}
-			case item.Class == "check":
-				schema = SchemaProperty{
-					Type:        "boolean",
-					Description: "Section: " + sectionTitle + ", field: " + item.Title,
-				}
-			case item.Class == "upload":
-				continue
-			default:
-				panic(fmt.Sprintf("Unknown item class: %s", item.Class))
-			}
-
-			// Используем ID элемента как ключ в схеме
-			if item.ID != "" {
-				properties[item.ID] = schema
-			}
-		}
-	}
-
-	return properties, nil
+	ChunkTokens  int
+	ChunkOverlap int
+	// ClassifyNodes puts nodes into the workspace forms, see classifyNodes.
+	ClassifyNodes bool
+	FormOptions   SchemaOptions
+	Users         []int
+	SimAPIKey     string
+	WorkspaceID   string
 }
 
 func usercode(ctx context.Context, data1 map[string]any) error {
+	if fd, ok := data1["form_data_req"].(map[string]any); ok {
+		return usercodeFormData(ctx, data1, fd)
+	}
+	if ff, ok := data1["fill_form_req"].(map[string]any); ok {
+		return usercodeFillForm(ctx, data1, ff)
+	}
+	if cf, ok := data1["classify_form_req"].(map[string]any); ok {
+		return usercodeClassifyForm(ctx, data1, cf)
+	}
+	if sf, ok := data1["schema_form_req"].(map[string]any); ok {
+		return usercodeSchemaForm(ctx, data1, sf)
+	}
+	if _, ok := data1["graph_maker_req"].(map[string]any); ok {
+		return usercode1(ctx, data1)
+	}
 	so, ok := data1["structured_output_req"].(map[string]any)
 	if so == nil || !ok {
 		fmt.Println("no structured_output")
@@ -250,23 +127,39 @@ func usercode(ctx context.Context, data1 map[string]any) error {
 		return fmt.Errorf("error1 unmarshaling input JSON: %w", err)
 	}
 
-	schema, err := convertToJSONSchema(f)
+	opts, err := schemaOptions(so)
+	if err != nil {
+		return fmt.Errorf("structured_output_req: %w", err)
+	}
+
+	parts, report, diagnostics, err := fitSchema(f, opts)
 	if err != nil {
 		fmt.Printf("Error converting to JSON Schema: %v\n", err)
 		return fmt.Errorf("error converting to JSON Schema: %w", err)
 	}
 
-	// Создаем финальную структуру схемы
-	finalSchema := map[string]interface{}{
-		"$schema":              "https://json-schema.org/draft/2020-12/schema",
-		"type":                 "object",
-		"additionalProperties": false,
-		"name":                 "structured_output",
-		"properties":           schema,
+	dialect, _ := so["dialect"].(string)
+	schemas := make([]map[string]any, 0, len(parts))
+	for i, part := range parts {
+		name := "structured_output"
+		if len(parts) > 1 {
+			name = fmt.Sprintf("structured_output_part_%d", i+1)
+		}
+		format, err := exportSchema(part.Schema, name, dialect, opts.Strict)
+		if err != nil {
+			return fmt.Errorf("error exporting JSON Schema: %w", err)
+		}
+		schemas = append(schemas, map[string]any{
+			"schema":   finalSchema(part.Schema, name),
+			"format":   format,
+			"sections": part.Sections,
+			"stats":    part.Stats,
+		})
 	}
+	schema := schemas[0]["schema"]
 
 	// Преобразуем схему обратно в JSON
-	result, err := json.MarshalIndent(finalSchema, "", "    ")
+	result, err := json.MarshalIndent(schema, "", "    ")
 	if err != nil {
 		fmt.Printf("Error marshaling result: %v\n", err)
 		return fmt.Errorf("error marshaling result: %w", err)
@@ -275,13 +168,36 @@ func usercode(ctx context.Context, data1 map[string]any) error {
 	fmt.Println(string(result))
 
 	data1["structured_output_rsp"] = map[string]any{
-		"schema": finalSchema,
-		"status": "ok",
+		"schema":      schema,
+		"format":      schemas[0]["format"],
+		"dialect":     dialect,
+		"schemas":     schemas,
+		"budget":      report,
+		"diagnostics": diagnostics,
+		"status":      "ok",
 	}
 
 	return nil
 }
 
+// finalSchema wraps a root object schema into the document handed to the LLM.
+// The if/then/else clauses of field conditions are kept in allOf.
+func finalSchema(schema SchemaProperty, name string) map[string]any {
+	// Создаем финальную структуру схемы
+	final := map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"type":                 "object",
+		"additionalProperties": false,
+		"name":                 name,
+		"properties":           schema.Properties,
+		"required":             schema.Required,
+	}
+	if len(schema.AllOf) > 0 {
+		final["allOf"] = schema.AllOf
+	}
+	return final
+}
+
 func usercode1(ctx context.Context, data1 map[string]any) error {
 	defer func() {
 		if r := recover(); r != nil {
@@ -297,18 +213,12 @@ func usercode1(ctx context.Context, data1 map[string]any) error {
 		return fmt.Errorf("no graph_maker field")
 	}
 	gmReq := data1["graph_maker_req"].(map[string]any)
-	if gmReq["open_api_key"] == nil {
-		return fmt.Errorf("no open_api_key field")
-	}
 	if gmReq["system_msg"] == nil {
 		gmReq["system_msg"] = "You are an expert in creating detailed graphs. You know how to arrange(visualize) actors on a graph beautifully."
 	}
 	if gmReq["user_msg"] == nil {
 		return fmt.Errorf("no msg field")
 	}
-	if gmReq["chunk_size"] == nil {
-		gmReq["chunk_size"] = 20000000.0
-	}
 	if gmReq["users"] == nil || len(gmReq["users"].([]any)) == 0 {
 		return fmt.Errorf("no users field")
 	}
@@ -318,34 +228,70 @@ func usercode1(ctx context.Context, data1 map[string]any) error {
 	if gmReq["workspace_id"] == nil {
 		return fmt.Errorf("no workspace_id field")
 	}
+	if gmReq["ref"] == nil {
+		// The ref of the task itself names the graph when the request has none.
+		if ref, ok := data1["ref"].(string); ok {
+			gmReq["ref"] = ref
+		}
+	}
 	if gmReq["ref"] == nil {
 		return fmt.Errorf("no ref field")
 	}
 
 	req := Request{
 		Ref:         gmReq["ref"].(string),
-		OpenAPIKey:  gmReq["open_api_key"].(string),
 		SystemMsg:   gmReq["system_msg"].(string),
 		UserMsg:     gmReq["user_msg"].(string),
-		ChunkSize:   int(gmReq["chunk_size"].(float64)),
 		SimAPIKey:   gmReq["sim_api_key"].(string),
 		WorkspaceID: gmReq["workspace_id"].(string),
 	}
 	if id, ok := gmReq["event_actor_id"].(string); ok {
 		req.EventActorID = id
 	}
-	users := gmReq["users"].([]any)
-	for _, uBin := range users {
-		u, err := strconv.Atoi(uBin.(string))
-		if err != nil {
-			return fmt.Errorf("failed to parse user ID: %v", err)
-		}
-		req.Users = append(req.Users, u)
+	req.OpenAPIKey, _ = gmReq["open_api_key"].(string)
+	req.Provider, _ = gmReq["provider"].(string)
+	if req.Provider == "" {
+		req.Provider = ProviderOpenAI
+	}
+	req.BaseURL, _ = gmReq["base_url"].(string)
+	req.APIKey, _ = gmReq["api_key"].(string)
+	params, err := graphParams(gmReq, req.Provider)
+	if err != nil {
+		return fmt.Errorf("graph_maker_req: %w", err)
+	}
+	req.Params = params
+	// Classification makes one model call per node, so it is opt-in.
+	if classify, ok := gmReq["classify_nodes"].(bool); ok {
+		req.ClassifyNodes = classify
+	}
+	req.FormOptions, err = schemaOptions(gmReq)
+	if err != nil {
+		return fmt.Errorf("graph_maker_req: %w", err)
+	}
+	// chunk_size is the token budget of a chunk, capped at the model's.
+	if size, ok := gmReq["chunk_size"].(float64); ok {
+		req.ChunkTokens = int(size)
+	}
+	req.ChunkOverlap = defaultChunkOverlap
+	if overlap, ok := gmReq["chunk_overlap"].(float64); ok {
+		req.ChunkOverlap = int(overlap)
+	}
+	req.Users, err = parseUsers(gmReq["users"].([]any))
+	if err != nil {
+		return err
 	}
 
-	initOnce(req)
-	graph := handle(ctx, req)
-	graphJSON, err := json.Marshal(graph)
+	extractor, err := newGraphExtractor(req)
+	if err != nil {
+		return err
+	}
+
+	aihands.Token = req.SimAPIKey
+	extraction, err := handle(ctx, req, extractor)
+	if err != nil {
+		return err
+	}
+	graphJSON, err := json.Marshal(extraction.Graph)
 	if err != nil {
 		return fmt.Errorf("failed to marshal graph: %v", err)
 	}
@@ -356,20 +302,53 @@ func usercode1(ctx context.Context, data1 map[string]any) error {
 	if err != nil {
 		return fmt.Errorf("failed to unmarshal graph JSON: %v", err)
 	}
+	graphMap["chunks"] = extraction.Chunks
+	graphMap["forms"] = extraction.Forms
+	graphMap["classify_errors"] = extraction.ClassifyErrors
+	graphMap["provider"] = req.Provider
+	graphMap["params"] = req.Params
+	graphMap["sources"] = extraction.Sources
 	data1["graph_maker_rsp"] = graphMap
 
 	return nil
 }
 
-func initOnce(req Request) {
-	once.Do(func() {
+// parseUsers reads the user IDs of a request, given as strings or numbers.
+func parseUsers(list []any) ([]int, error) {
+	users := make([]int, 0, len(list))
+	for _, uBin := range list {
+		if n, ok := uBin.(float64); ok {
+			users = append(users, int(n))
+			continue
+		}
+		s, _ := uBin.(string)
+		u, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse user ID: %v", err)
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
 
-		aihands.Token = req.SimAPIKey
-		client = openai.NewClient(option.WithAPIKey(req.OpenAPIKey))
-	})
+// grantTemplateAccess lets users see the template formID and its actors.
+func grantTemplateAccess(formID int, users []int) {
+	for _, userID := range users {
+		aihands.AddAccess("formTemplate", formID, userID)
+		aihands.AddAccess("templateActors", formID, userID)
+	}
 }
 
-func handle(ctx context.Context, req Request) Graph {
+func handle(ctx context.Context, req Request, extractor GraphExtractor) (Extraction, error) {
+	// An explicit chunk_size can only make chunks smaller than the model allows.
+	budget, err := chunkBudget(req.Params, req.SystemMsg)
+	if err != nil {
+		return Extraction{}, err
+	}
+	if req.ChunkTokens > 0 && req.ChunkTokens < budget {
+		budget = req.ChunkTokens
+	}
+
 	rsp := aihands.SystemForms(req.WorkspaceID)
 	if rsp["data"] == nil {
 		panic("no forms")
@@ -393,89 +372,110 @@ func handle(ctx context.Context, req Request) Graph {
 	formsCustom := rspCustom["data"].([]any)
 	for _, form1 := range formsCustom {
 		form := form1.(map[string]any)
-		if form["title"].(string) == "GraphMakerForm." {
+		if form["title"].(string) == graphMakerFormTitle {
 			req.FormID = int(form["id"].(float64))
+			// The form list may leave out the sections.
+			if f, err := loadForm(req.FormID); err == nil {
+				req.FormSections = f.Sections
+			}
 			break
 		}
 	}
 	if req.FormID == 0 {
-		req.FormID = aihands.CreateTemplate(req.WorkspaceID, "GraphMakerForm.", []map[string]any{})
-		for _, userID := range req.Users {
-			aihands.AddAccess("formTemplate", req.FormID, userID)
-			aihands.AddAccess("templateActors", req.FormID, userID)
+		sections, err := templateSections(Form{Sections: graphMakerSections})
+		if err != nil {
+			panic(err.Error())
 		}
+		req.FormID = aihands.CreateTemplate(req.WorkspaceID, graphMakerFormTitle, sections)
+		req.FormSections = graphMakerSections
+		grantTemplateAccess(req.FormID, req.Users)
 
 	}
 
-	linksType := aihands.GetTypeLinks(req.WorkspaceID)
-	if linksType["data"] == nil {
-		panic("no links")
+	types, err := edgeTypes(aihands.GetTypeLinks(req.WorkspaceID))
+	if err != nil {
+		return Extraction{}, err
 	}
-	links := linksType["data"].([]any)
-	for _, link1 := range links {
-		link := link1.(map[string]any)
-		if link["name"].(string) == "hierarchy" {
-			req.LinkType = int(link["id"].(float64))
-		}
+	if len(types) == 0 {
+		return Extraction{}, fmt.Errorf("workspace %s has no edge types, create one to link the graph nodes", req.WorkspaceID)
+	}
+	req.EdgeTypes = types
+	req.LinkType, err = hierarchyType(req.WorkspaceID, types)
+	if err != nil {
+		return Extraction{}, err
 	}
 
 	//rsp1 := controlapi.GetActor(req.WorkspaceID)
 	//fmt.Println(rsp1)
-	chunks := splitIntoChunks(req.UserMsg, req.ChunkSize)
-	gid, lid := prepareGraph(req)
-	for _, chunk := range chunks {
-		schemaParam := openai.ResponseFormatJSONSchemaJSONSchemaParam{
-			Name:        openai.F("structured_output"),
-			Description: openai.F("The structured output of the model"),
-			Schema:      openai.F(Schema),
-			Strict:      openai.Bool(true),
-		}
-
-		// Query the Chat Completions API
-		chat, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-			Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
-				openai.SystemMessage(req.SystemMsg),
-				openai.UserMessage(chunk),
-			}),
-			ResponseFormat: openai.F[openai.ChatCompletionNewParamsResponseFormatUnion](
-				openai.ResponseFormatJSONSchemaParam{
-					Type:       openai.F(openai.ResponseFormatJSONSchemaTypeJSONSchema),
-					JSONSchema: openai.F(schemaParam),
-				},
-			),
-			// Only certain models can perform structured outputs
-			Model: openai.F(openai.ChatModelGPT4o2024_08_06),
+	chunks := splitIntoChunks(req.UserMsg, budget, req.ChunkOverlap)
+	extraction, err := extractGraph(ctx, extractor, edgeTypedSchema(types), req.SystemMsg, chunks)
+	if err != nil {
+		return Extraction{}, err
+	}
+
+	var nodeForms []Form
+	var loadErrs []ClassifyError
+	if req.ClassifyNodes {
+		nodeForms, loadErrs = workspaceForms(rspCustom, req.FormID)
+	}
+	settings := FillSettings{
+		Model:       req.Params.Model,
+		SystemMsg:   defaultNodeFormSystemMsg,
+		Temperature: req.Params.Temperature,
+		TopP:        req.Params.TopP,
+		Seed:        req.Params.Seed,
+		MaxTokens:   req.Params.MaxTokens,
+	}
+	if c, ok := extractor.(chatBackend); ok {
+		settings.Chat = c.Chat
+	}
+	catchAll := Form{ID: req.FormID, Sections: req.FormSections}
+	extraction.Forms = classifyNodes(ctx, extraction, nodeForms, catchAll, req.FormOptions, settings)
+	extraction.ClassifyErrors = append(classifyErrors(extraction.Graph, extraction.Forms), loadErrs...)
+	if req.ClassifyNodes && len(nodeForms) == 0 {
+		extraction.ClassifyErrors = append(extraction.ClassifyErrors, ClassifyError{
+			Error: "no workspace form with fields to classify nodes into, all nodes use " + graphMakerFormTitle,
 		})
+	}
 
-		if err != nil {
-			panic(err.Error())
-		}
-
-		// The model responds with a JSON string, so parse it into a struct
-		graph := Graph{}
-		err = json.Unmarshal([]byte(chat.Choices[0].Message.Content), &graph)
-		if err != nil {
-			panic(err.Error())
-		}
-
-		// Use the model's structured response with a native Go struct
-		//prettified, err := json.MarshalIndent(graph, "", "  ")
-		//if err != nil {
-		//	panic(err.Error())
-		//}
-		//fmt.Println(string(prettified))
+	gid, lid := prepareGraph(req)
+	makeGraph(lid, req, extraction)
+	if req.EventActorID != "" {
+		linkToGraph :=
+			fmt.Sprintf("https://sim.simulator.company/actors_graph/%s/graph/%s/layers/%s", req.WorkspaceID, gid, lid)
+		aihands.CreateComment(req.EventActorID, "The graph is created based on the event content:\r\n"+linkToGraph)
+	}
+	return extraction, nil
+}
 
-		makeGraph(lid, req, graph)
-		if req.EventActorID != "" {
-			linkToGraph :=
-				fmt.Sprintf("https://sim.simulator.company/actors_graph/%s/graph/%s/layers/%s", req.WorkspaceID, gid, lid)
-			aihands.CreateComment(req.EventActorID, "The graph is created based on the event content:\r\n"+linkToGraph)
-		}
-		return graph
+// graphSchema is Schema in the form validateSchema understands.
+var graphSchema = mustSchemaProperty(Schema)
 
+func mustSchemaProperty(schema any) SchemaProperty {
+	property, err := toSchemaProperty(schema)
+	if err != nil {
+		panic(err)
 	}
-	panic("chunking not implemented")
+	return property
+}
 
+// parseGraph repairs and validates the model response against schema before
+// decoding it.
+func parseGraph(schema SchemaProperty, content string) (Graph, error) {
+	graph := Graph{}
+	response, errs, err := checkResponse(schema, content, true)
+	if err != nil {
+		return graph, err
+	}
+	if len(errs) > 0 {
+		return graph, fmt.Errorf("invalid graph: %w", joinValidationErrors(errs))
+	}
+	bin, err := json.Marshal(response)
+	if err != nil {
+		return graph, err
+	}
+	err = json.Unmarshal(bin, &graph)
+	return graph, err
 }
 
 type Info struct {
@@ -487,12 +487,12 @@ var linksRefs = make(map[string]Info)
 var linkLLMID = make(map[string]string)
 
 func prepareGraph(req Request) (string, string) {
-	gid := aihands.CreateActor("", req.Ref, req.GraphFormID, map[string]any{}, nil, nil, "")
+	gid := aihands.CreateActor("", req.Ref, "", req.GraphFormID, map[string]any{}, nil, nil, "")
 	for _, userID := range req.Users {
 		aihands.AddAccessString("actor", gid, userID)
 	}
 	lid := aihands.CreateLayerActor("Layer", req.LayerFormID)
-	aihands.CreateLink(req.LinkType, req.WorkspaceID, gid, lid)
+	aihands.CreateLink(req.LinkType, req.WorkspaceID, gid, lid, "", nil)
 	for _, userID := range req.Users {
 		aihands.AddAccessString("actor", lid, userID)
 	}
@@ -500,7 +500,8 @@ func prepareGraph(req Request) (string, string) {
 
 }
 
-func makeGraph(lid string, req Request, graph Graph) {
+func makeGraph(lid string, req Request, extraction Extraction) {
+	graph := extraction.Graph
 	for _, n := range graph.Nodes {
 		ref := req.Ref + "." + n.Name
 		ref = url.QueryEscape(ref)
@@ -510,7 +511,11 @@ func makeGraph(lid string, req Request, graph Graph) {
 		//	linkLLMID[n.ID] = ref
 		//	continue
 		//}
-		id := aihands.CreateActor(ref, n.Name, req.FormID, map[string]any{}, nil, nil, "")
+		nf, ok := extraction.Forms[n.ID]
+		if !ok {
+			nf = NodeForm{FormID: req.FormID, Data: nodeFormData(n, req.FormSections)}
+		}
+		id := aihands.CreateActor(ref, n.Name, n.Description, nf.FormID, nf.Data, nil, nil, "")
 		laID := aihands.AddToLayer("node", id, lid, n.X, n.Y)
 		linkLLMID[n.ID] = ref
 		linksRefs[ref] = Info{laID: laID, id: id}
@@ -518,13 +523,47 @@ func makeGraph(lid string, req Request, graph Graph) {
 	}
 	for _, e := range graph.Edges {
 
-		id := aihands.CreateLink(req.LinkType, req.WorkspaceID, getActor(e.Source).id, getActor(e.Target).id)
+		id := aihands.CreateLink(req.linkType(e), req.WorkspaceID, getActor(e.Source).id, getActor(e.Target).id, e.Label, edgeLinkData(e))
 		fmt.Println(getActor(e.Source), getActor(e.Target), id)
 		aihands.AddToLayer1("edge", id, lid, getActor(e.Source).laID, getActor(e.Target).laID)
 	}
 
 }
 
+// graphMakerSections are the fields of the graphMakerFormTitle template.
+var graphMakerSections = []Section{{
+	Title: "Node",
+	Content: []Content{
+		{ID: "type", Class: "edit", Title: "Type"},
+		{ID: "attributes", Class: "edit", Title: "Attributes"},
+	},
+}}
+
+// nodeFormData is the catch-all form data of a node: its type and its
+// attributes, one "key: value" line each. Only the fields sections of the
+// catch-all form have are set, so an older form without them gets none.
+func nodeFormData(n Node, sections []Section) map[string]any {
+	lines := make([]string, 0, len(n.Attributes))
+	for _, a := range n.Attributes {
+		lines = append(lines, a.Key+": "+a.Value)
+	}
+	values := map[string]any{"type": n.Type, "attributes": strings.Join(lines, "\n")}
+	data := make(map[string]any, len(values))
+	for _, section := range sections {
+		for _, item := range section.Content {
+			if v, ok := values[item.ID]; ok {
+				data[item.ID] = v
+			}
+		}
+	}
+	return data
+}
+
+// edgeLinkData is the link metadata of an edge.
+func edgeLinkData(e Edge) map[string]any {
+	return map[string]any{"type": e.Type, "relationship": e.Label, "directed": e.Directed, "weight": e.Weight}
+}
+
 func getActor(id string) Info {
 	rsp := linksRefs[linkLLMID[id]]
 	if rsp.id == "" {
@@ -534,17 +573,6 @@ func getActor(id string) Info {
 	return rsp
 }
 
-func splitIntoChunks(s string, size int) []string {
-	var chunks []string
-	runes := []rune(s)
-	for len(runes) > size {
-		chunks = append(chunks, string(runes[:size]))
-		runes = runes[size:]
-	}
-	chunks = append(chunks, string(runes))
-	return chunks
-}
-
 func StackTrace() string {
 
 	var builder strings.Builder
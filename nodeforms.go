@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"graph_maker/aihands"
+)
+
+// graphMakerFormTitle is the catch-all form of nodes no workspace form fits.
+const graphMakerFormTitle = "GraphMakerForm."
+
+const defaultNodeFormSystemMsg = "You sort the entities of a knowledge graph into forms. " +
+	"Choose the one form that fits the entity best, set formId to its ID and fill it in from what is known about the entity. " +
+	"Choose the \"Other\" form when none of the others fits. Only use facts stated about the entity. " +
+	"For every field you fill, add an evidence entry with your confidence from 0 to 1 and the exact quote of the text it comes from."
+
+// NodeForm is the form the actor of a node is created in, with its form data.
+type NodeForm struct {
+	FormID    int            `json:"form_id"`
+	FormTitle string         `json:"form_title"`
+	Data      map[string]any `json:"data"`
+	// Error tells why the node fell back to the catch-all form.
+	Error string `json:"error,omitempty"`
+}
+
+// ClassifyError is a classification failure. Node is empty when no node
+// could be classified.
+type ClassifyError struct {
+	Node  string `json:"node,omitempty"`
+	Error string `json:"error"`
+}
+
+// classifyErrors lists the nodes of graph that fell back to the catch-all
+// form because classification failed, in graph order.
+func classifyErrors(graph Graph, forms map[string]NodeForm) []ClassifyError {
+	errs := make([]ClassifyError, 0)
+	for _, n := range graph.Nodes {
+		if nf, ok := forms[n.ID]; ok && nf.Error != "" {
+			errs = append(errs, ClassifyError{Node: n.ID, Error: nf.Error})
+		}
+	}
+	return errs
+}
+
+// getForm loads a form with its sections. Replaced in tests.
+var getForm = aihands.GetForm
+
+// workspaceForms are the forms of a CustomForms response nodes can be
+// classified into: the ones with fields, except the catch-all form exclude.
+// The list does not always carry the sections of its forms, so each one is
+// loaded in full; the ones that fail to load are reported.
+func workspaceForms(rsp map[string]any, exclude int) ([]Form, []ClassifyError) {
+	list, _ := rsp["data"].([]any)
+	forms := make([]Form, 0, len(list))
+	errs := make([]ClassifyError, 0)
+	for _, item := range list {
+		f, err := parseForm(item)
+		if err != nil || f.ID == 0 || f.ID == exclude || f.Title == graphMakerFormTitle {
+			continue
+		}
+		f, err = loadForm(f.ID)
+		if err != nil {
+			errs = append(errs, ClassifyError{Error: fmt.Sprintf("form %d: %v", f.ID, err)})
+			continue
+		}
+		for _, section := range f.Sections {
+			if len(section.Content) > 0 {
+				forms = append(forms, f)
+				break
+			}
+		}
+	}
+	return forms, errs
+}
+
+// loadForm reads the form formID with its sections.
+func loadForm(formID int) (Form, error) {
+	rsp := getForm(formID)
+	data, ok := rsp["data"].(map[string]any)
+	if !ok {
+		return Form{ID: formID}, fmt.Errorf("no form in response: %v", rsp["error"])
+	}
+	f, err := parseForm(data)
+	f.ID = formID
+	return f, err
+}
+
+// otherForm is the catch-all form as a classification choice.
+func otherForm(catchAll Form) Form {
+	return Form{ID: catchAll.ID, Title: "Other", Description: "None of the other forms fits the entity", Sections: catchAll.Sections}
+}
+
+// classifyNodes lets the model put every node of extraction into the form
+// that fits it best and fill that form from the node and the chunks it was
+// found in. Nodes go to the catch-all form fallback when no form fits or
+// classification fails.
+func classifyNodes(ctx context.Context, extraction Extraction, forms []Form, fallback Form, opts SchemaOptions, settings FillSettings) map[string]NodeForm {
+	result := make(map[string]NodeForm, len(extraction.Graph.Nodes))
+	catchAll := func(n Node, err error) {
+		nf := NodeForm{FormID: fallback.ID, FormTitle: graphMakerFormTitle, Data: nodeFormData(n, fallback.Sections)}
+		if err != nil {
+			nf.Error = err.Error()
+		}
+		result[n.ID] = nf
+	}
+	if len(forms) == 0 {
+		for _, n := range extraction.Graph.Nodes {
+			catchAll(n, nil)
+		}
+		return result
+	}
+
+	candidates := append(append([]Form(nil), forms...), otherForm(fallback))
+	schema, err := classifySchema(candidates, opts)
+	for _, n := range extraction.Graph.Nodes {
+		if err != nil {
+			catchAll(n, err)
+			continue
+		}
+		c, err := classifyText(ctx, schema, candidates, nodeText(n, extraction), opts, settings)
+		if err != nil || c.FormID == fallback.ID {
+			catchAll(n, err)
+			continue
+		}
+		result[n.ID] = NodeForm{FormID: c.FormID, FormTitle: c.FormTitle, Data: c.Data}
+	}
+	return result
+}
+
+// nodeText describes a node for classification, followed by the text of
+// the chunks it was found in.
+func nodeText(n Node, extraction Extraction) string {
+	var b strings.Builder
+	b.WriteString("Entity: " + n.Name + "\n")
+	if n.Type != "" {
+		b.WriteString("Type: " + n.Type + "\n")
+	}
+	if n.Description != "" {
+		b.WriteString("Description: " + n.Description + "\n")
+	}
+	if len(n.Attributes) > 0 {
+		b.WriteString("Attributes:\n")
+		for _, a := range n.Attributes {
+			b.WriteString("- " + a.Key + ": " + a.Value + "\n")
+		}
+	}
+	for _, i := range extraction.Sources[n.ID] {
+		if i < len(extraction.Chunks) {
+			b.WriteString("\nText it was found in:\n" + strings.TrimSpace(extraction.Chunks[i].Text) + "\n")
+		}
+	}
+	return b.String()
+}
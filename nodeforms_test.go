@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspaceForms(t *testing.T) {
+	saved := getForm
+	t.Cleanup(func() { getForm = saved })
+	var loaded []int
+	getForm = func(formID int) map[string]any {
+		loaded = append(loaded, formID)
+		switch formID {
+		case 12:
+			return map[string]any{"data": map[string]any{"id": 12.0, "title": "Person", "sections": []any{map[string]any{
+				"title": "main", "content": []any{map[string]any{"id": "full_name", "class": "edit", "title": "Full name"}},
+			}}}}
+		case 13:
+			return map[string]any{"data": map[string]any{"id": 13.0, "title": "Empty", "sections": []any{}}}
+		}
+		return map[string]any{"error": "not found"}
+	}
+
+	// The list leaves out the sections, the forms are loaded one by one.
+	forms, errs := workspaceForms(map[string]any{"data": []any{
+		map[string]any{"id": 12.0, "title": "Person"},
+		map[string]any{"id": 13.0, "title": "Empty"},
+		map[string]any{"id": 14.0, "title": "Gone"},
+		map[string]any{"id": 99.0, "title": graphMakerFormTitle},
+	}}, 99)
+	require.Len(t, forms, 1)
+	require.Equal(t, 12, forms[0].ID)
+	require.Equal(t, "full_name", forms[0].Sections[0].Content[0].ID)
+	require.Equal(t, []ClassifyError{{Error: "form 14: no form in response: not found"}}, errs)
+	require.Equal(t, []int{12, 13, 14}, loaded)
+}
+
+func TestClassifyNodes(t *testing.T) {
+	extraction := Extraction{
+		Graph: Graph{Nodes: []Node{
+			{ID: "1", Name: "Ann Lee", Type: "person", Attributes: []Attribute{{Key: "role", Value: "CTO"}}},
+			{ID: "2", Name: "Acme", Type: "organization"},
+			{ID: "3", Name: "Bob"},
+		}},
+		Chunks:  []Chunk{{Text: "Ann Lee is the CTO of Acme. "}, {Text: "Bob met Ann Lee."}},
+		Sources: map[string][]int{"1": {0, 1}, "2": {0}, "3": {1}},
+	}
+	answers := []string{
+		`{"form": {"formId": "12", "values": {"full_name": "Ann Lee"}, "evidence": []}}`,
+		`{"form": {"formId": "99", "values": {"type": "organization", "attributes": ""}, "evidence": []}}`,
+		`{"form": {"formId": "42", "values": {}, "evidence": []}}`,
+	}
+	var requests []ChatRequest
+	seed, topP := int64(7), 0.5
+	settings := FillSettings{SystemMsg: defaultNodeFormSystemMsg, Seed: &seed, TopP: &topP, Chat: func(_ context.Context, req ChatRequest) (string, error) {
+		requests = append(requests, req)
+		answer := answers[0]
+		answers = answers[1:]
+		return answer, nil
+	}}
+	forms := classifyNodes(context.Background(), extraction, classifyForms()[1:], Form{ID: 99, Sections: graphMakerSections}, SchemaOptions{Strict: true}, settings)
+
+	require.Equal(t, NodeForm{FormID: 12, FormTitle: "Person", Data: map[string]any{"full_name": "Ann Lee"}}, forms["1"])
+	require.Equal(t, NodeForm{FormID: 99, FormTitle: graphMakerFormTitle, Data: map[string]any{"type": "organization", "attributes": ""}}, forms["2"])
+	require.Equal(t, 99, forms["3"].FormID)
+	require.NotEmpty(t, forms["3"].Error)
+	require.Equal(t, []ClassifyError{{Node: "3", Error: forms["3"].Error}}, classifyErrors(extraction.Graph, forms))
+	require.Equal(t, &seed, requests[0].Seed)
+	require.Equal(t, &topP, requests[0].TopP)
+	require.Equal(t, "Entity: Ann Lee\nType: person\nAttributes:\n- role: CTO\n\nText it was found in:\nAnn Lee is the CTO of Acme.\n"+
+		"\nText it was found in:\nBob met Ann Lee.\n", requests[0].UserMsg)
+	require.Len(t, *requests[0].Schema.(SchemaProperty).Properties["form"].AnyOf[1].Properties["formId"].Enum, 1)
+
+	forms = classifyNodes(context.Background(), extraction, nil, Form{ID: 99, Sections: graphMakerSections}, SchemaOptions{Strict: true}, settings)
+	require.Equal(t, NodeForm{FormID: 99, FormTitle: graphMakerFormTitle, Data: map[string]any{"type": "", "attributes": ""}}, forms["3"])
+
+	// A catch-all form created before the type and attributes fields gets no data.
+	forms = classifyNodes(context.Background(), extraction, nil, Form{ID: 99}, SchemaOptions{Strict: true}, settings)
+	require.Equal(t, NodeForm{FormID: 99, FormTitle: graphMakerFormTitle, Data: map[string]any{}}, forms["3"])
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"graph_maker/aihands"
+)
+
+const (
+	// actorFilterPageSize is the page size used when reading actor filters.
+	actorFilterPageSize = 200
+	// defaultMaxFilterOptions caps how many actors a filter may expand into an enum.
+	defaultMaxFilterOptions = 1000
+)
+
+// errFilterTooLarge is returned when an actor filter has more actors than the
+// converter is allowed to inline. Such fields fall back to a free-form actor ID.
+var errFilterTooLarge = errors.New("actor filter exceeds option limit")
+
+// loadFilterPage reads one page of an actor filter. Replaced in tests.
+var loadFilterPage = func(filterID string, limit, offset int) map[string]any {
+	return aihands.GetActorsByFilterPage(filterID, "", "", limit, offset)
+}
+
+// optionResolver turns select options, including ones sourced from actor
+// filters, into a flat list of options. Filters are read once per resolver.
+type optionResolver struct {
+	maxOptions int
+	cache      map[string][]Option
+}
+
+func newOptionResolver(maxOptions int) *optionResolver {
+	if maxOptions <= 0 {
+		maxOptions = defaultMaxFilterOptions
+	}
+	return &optionResolver{
+		maxOptions: maxOptions,
+		cache:      make(map[string][]Option),
+	}
+}
+
+func (r *optionResolver) resolve(item Content) ([]Option, error) {
+	if len(item.Options) > 0 {
+		return item.Options, nil
+	}
+	if item.Extra == nil || item.Extra.OptionsSource == nil {
+		return nil, nil
+	}
+	switch item.Extra.OptionsSource.Type {
+	case "actorFilter":
+		if item.Extra.OptionsSource.Value.ID == "" {
+			return nil, nil
+		}
+		return r.actorFilter(item.Extra.OptionsSource.Value.ID)
+	default:
+		return nil, fmt.Errorf("unknown extra options source type %s", item.Extra.OptionsSource.Type)
+	}
+}
+
+func (r *optionResolver) actorFilter(filterID string) ([]Option, error) {
+	if options, ok := r.cache[filterID]; ok {
+		if options == nil {
+			return nil, errFilterTooLarge
+		}
+		return options, nil
+	}
+	options := make([]Option, 0)
+	for offset := 0; ; {
+		actors, total := filterActors(loadFilterPage(filterID, actorFilterPageSize, offset))
+		if total > r.maxOptions || len(options)+len(actors) > r.maxOptions {
+			r.cache[filterID] = nil
+			return nil, fmt.Errorf("filter %s: %w", filterID, errFilterTooLarge)
+		}
+		for _, a := range actors {
+			actor, ok := a.(map[string]any)
+			if !ok {
+				continue
+			}
+			id, _ := actor["id"].(string)
+			if id == "" {
+				continue
+			}
+			title, _ := actor["title"].(string)
+			options = append(options, Option{Title: title, Value: id})
+		}
+		offset += len(actors)
+		if len(actors) < actorFilterPageSize || (total > 0 && offset >= total) {
+			break
+		}
+	}
+	r.cache[filterID] = options
+	return options, nil
+}
+
+// filterActors extracts the actor list and the total count from an
+// actors_filters response. The total is 0 when the API does not report it.
+func filterActors(rsp map[string]any) ([]any, int) {
+	switch data := rsp["data"].(type) {
+	case []any:
+		return data, 0
+	case map[string]any:
+		list, _ := data["list"].([]any)
+		total, _ := data["total"].(float64)
+		return list, int(total)
+	}
+	return nil, 0
+}
+
+func optionEnum(options []Option) *[]string {
+	if len(options) == 0 {
+		return nil
+	}
+	enum := make([]string, 0, len(options))
+	for _, option := range options {
+		enum = append(enum, option.Value)
+	}
+	return &enum
+}
+
+func optionOneOf(options []Option) *[]OneOf {
+	if len(options) == 0 {
+		return nil
+	}
+	oneOf := make([]OneOf, 0, len(options))
+	for _, option := range options {
+		oneOf = append(oneOf, OneOf{
+			Const: option.Value,
+			Title: option.Title,
+		})
+	}
+	return &oneOf
+}
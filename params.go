@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/openai/openai-go"
+)
+
+// GraphParams are the model and sampling parameters of graph extraction.
+// Unset sampling parameters are left to the provider's defaults.
+type GraphParams struct {
+	Model       string   `json:"model"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	Seed        *int64   `json:"seed,omitempty"`
+	MaxTokens   *int64   `json:"max_tokens,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+}
+
+// modelLimits are the context window and the maximum output of a model, in
+// tokens.
+type modelLimits struct {
+	context, output int
+}
+
+// structuredOutputModels are the OpenAI models that take a strict JSON schema
+// response format, with the limits chunks are sized for. Self-hosted models
+// are not checked: what they support is up to the server.
+var structuredOutputModels = map[string]modelLimits{
+	openai.ChatModelGPT4o:               {128000, 16384},
+	openai.ChatModelGPT4o2024_08_06:     {128000, 16384},
+	openai.ChatModelGPT4o2024_11_20:     {128000, 16384},
+	openai.ChatModelGPT4oMini:           {128000, 16384},
+	openai.ChatModelGPT4oMini2024_07_18: {128000, 16384},
+}
+
+// limits are the token limits of the model of p; models that are not
+// listed get the defaults.
+func (p GraphParams) limits() modelLimits {
+	if limits, ok := structuredOutputModels[p.Model]; ok {
+		return limits
+	}
+	return modelLimits{defaultContextTokens, defaultOutputTokens}
+}
+
+// graphParams reads the model and sampling parameters of graph_maker_req.
+// The model defaults to graphModel for OpenAI and must be given otherwise.
+func graphParams(req map[string]any, provider string) (GraphParams, error) {
+	params := GraphParams{}
+	params.Model, _ = req["model"].(string)
+	if params.Model == "" && provider != ProviderOpenAICompatible {
+		params.Model = graphModel
+	}
+	if v, ok := req["temperature"].(float64); ok {
+		params.Temperature = &v
+	}
+	if v, ok := req["top_p"].(float64); ok {
+		params.TopP = &v
+	}
+	if v, ok := req["seed"].(float64); ok {
+		seed := int64(v)
+		params.Seed = &seed
+	}
+	if v, ok := req["max_tokens"].(float64); ok {
+		maxTokens := int64(v)
+		params.MaxTokens = &maxTokens
+	}
+	return params, params.validate(provider)
+}
+
+func (p GraphParams) validate(provider string) error {
+	var errs []error
+	if _, ok := structuredOutputModels[p.Model]; provider != ProviderOpenAICompatible && !ok {
+		models := make([]string, 0, len(structuredOutputModels))
+		for model := range structuredOutputModels {
+			models = append(models, model)
+		}
+		sort.Strings(models)
+		errs = append(errs, fmt.Errorf("model %q does not support structured output, expected one of %v", p.Model, models))
+	}
+	if p.Temperature != nil && (*p.Temperature < 0 || *p.Temperature > 2) {
+		errs = append(errs, fmt.Errorf("temperature %v is not between 0 and 2", *p.Temperature))
+	}
+	if p.TopP != nil && (*p.TopP <= 0 || *p.TopP > 1) {
+		errs = append(errs, fmt.Errorf("top_p %v is not in (0, 1]", *p.TopP))
+	}
+	if p.MaxTokens != nil && *p.MaxTokens <= 0 {
+		errs = append(errs, fmt.Errorf("max_tokens %d is not positive", *p.MaxTokens))
+	}
+	if limits, ok := structuredOutputModels[p.Model]; ok && p.MaxTokens != nil && *p.MaxTokens > int64(limits.output) {
+		errs = append(errs, fmt.Errorf("max_tokens %d is above the %d output tokens of %s", *p.MaxTokens, limits.output, p.Model))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphParams(t *testing.T) {
+	params, err := graphParams(map[string]any{}, ProviderOpenAI)
+	require.NoError(t, err)
+	require.Equal(t, GraphParams{Model: graphModel}, params)
+
+	params, err = graphParams(map[string]any{
+		"model": "gpt-4o-mini", "temperature": 0.2, "top_p": 0.9, "seed": 42.0, "max_tokens": 2048.0,
+	}, ProviderOpenAI)
+	require.NoError(t, err)
+	bin, err := json.Marshal(params)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"model": "gpt-4o-mini", "temperature": 0.2, "top_p": 0.9, "seed": 42, "max_tokens": 2048}`, string(bin))
+
+	_, err = graphParams(map[string]any{"model": "gpt-3.5-turbo", "temperature": 3.0, "top_p": 0.0, "max_tokens": -1.0}, ProviderOpenAI)
+	require.ErrorContains(t, err, `model "gpt-3.5-turbo" does not support structured output`)
+	require.ErrorContains(t, err, "temperature 3 is not between 0 and 2")
+	require.ErrorContains(t, err, "top_p 0 is not in (0, 1]")
+	require.ErrorContains(t, err, "max_tokens -1 is not positive")
+
+	_, err = graphParams(map[string]any{"model": "gpt-4o", "max_tokens": 20000.0}, ProviderOpenAI)
+	require.EqualError(t, err, "max_tokens 20000 is above the 16384 output tokens of gpt-4o")
+
+	params, err = graphParams(map[string]any{"model": "llama3"}, ProviderOpenAICompatible)
+	require.NoError(t, err)
+	require.Equal(t, "llama3", params.Model)
+}
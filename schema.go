@@ -0,0 +1,438 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Section struct {
+	Title   string    `json:"title"`
+	Content []Content `json:"content"`
+}
+
+type ExtraValue struct {
+	ID string `json:"id"`
+}
+type ExtraOptionsSource struct {
+	Type  string     `json:"type"`
+	Value ExtraValue `json:"value"`
+}
+type Extra struct {
+	OptionsSource *ExtraOptionsSource `json:"optionsSource,omitempty"`
+	// Min and Max bound the value of the field; for multiSelect, link and
+	// table they bound the number of chosen options or rows.
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+	// Precision is the number of decimal places of number and currency fields.
+	Precision *int `json:"precision,omitempty"`
+	// Currency is the ISO 4217 code of a currency field.
+	Currency string `json:"currency,omitempty"`
+	// Columns describes the cells of a table row.
+	Columns []Content `json:"columns,omitempty"`
+}
+
+type Form struct {
+	// ID is the platform form ID; classification uses it as the discriminator.
+	ID          int       `json:"id,omitempty"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Sections    []Section `json:"sections"`
+}
+
+// Content представляет структуру входного JSON элемента
+type Content struct {
+	ID           string      `json:"id"`
+	Class        string      `json:"class"`
+	Title        string      `json:"title"`
+	Value        interface{} `json:"value,omitempty"`
+	Options      []Option    `json:"options,omitempty"`
+	Visibility   string      `json:"visibility,omitempty"`
+	Key          string      `json:"key,omitempty"`
+	IDNotChanged bool        `json:"idNotChanged,omitempty"`
+	Required     bool        `json:"required,omitempty"`
+	Extra        *Extra      `json:"extra,omitempty"`
+	// Conditions show the field only while all of them hold.
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// Condition holds while the field Field has one of Values. Check fields are
+// compared as "true" and "false".
+type Condition struct {
+	Field  string   `json:"field"`
+	Values []string `json:"values"`
+}
+
+// hidden reports whether the field is not shown to the model at all.
+func (c Content) hidden() bool {
+	return c.Visibility == "disabled" || c.Visibility == "hidden"
+}
+
+// locked reports whether the field already has a value that must not change.
+func (c Content) locked() bool {
+	return c.hasValue() && (c.IDNotChanged || c.Visibility == "readonly" || c.Visibility == "readOnly")
+}
+
+func (c Content) hasValue() bool {
+	switch v := c.Value.(type) {
+	case nil:
+		return false
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	}
+	return true
+}
+
+// describeValue renders a platform form value the way the model would write it:
+// select values by their option value, everything else as JSON.
+func describeValue(v any) string {
+	switch value := v.(type) {
+	case []any:
+		values := make([]any, 0, len(value))
+		for _, item := range value {
+			if option, ok := item.(map[string]any); ok && option["value"] != nil {
+				values = append(values, option["value"])
+			} else {
+				values = append(values, item)
+			}
+		}
+		if len(values) == 1 {
+			return describeValue(values[0])
+		}
+		v = values
+	case map[string]any:
+		if value["value"] != nil && len(value) <= 2 {
+			return describeValue(value["value"])
+		}
+	}
+	bin, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(bin)
+}
+
+// Option представляет структуру опции
+type Option struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type OneOf struct {
+	Const any    `json:"const"`
+	Title string `json:"title"`
+}
+
+// SchemaProperty представляет свойство JSON Schema
+type SchemaProperty struct {
+	Type        string                    `json:"type,omitempty"`
+	Title       string                    `json:"title,omitempty"`
+	Description string                    `json:"description,omitempty"`
+	Properties  map[string]SchemaProperty `json:"properties,omitempty"`
+	Required    []string                  `json:"required,omitempty"`
+	Enum        *[]string                 `json:"enum,omitempty"`
+	OneOf       *[]OneOf                  `json:"oneOf,omitempty"`
+	Items       *SchemaProperty           `json:"items,omitempty"`
+	UniqueItems bool                      `json:"uniqueItems,omitempty"`
+	MinItems    *int                      `json:"minItems,omitempty"`
+	MaxItems    *int                      `json:"maxItems,omitempty"`
+	Format      string                    `json:"format,omitempty"`
+	Pattern     string                    `json:"pattern,omitempty"`
+	Minimum     *float64                  `json:"minimum,omitempty"`
+	Maximum     *float64                  `json:"maximum,omitempty"`
+	// AnyOf is only used without Type, to let the model choose between schemas.
+	AnyOf []SchemaProperty `json:"anyOf,omitempty"`
+	// AllOf, If, Then, Else, Contains and Const express field conditions.
+	AllOf    []SchemaProperty `json:"allOf,omitempty"`
+	If       *SchemaProperty  `json:"if,omitempty"`
+	Then     *SchemaProperty  `json:"then,omitempty"`
+	Else     *SchemaProperty  `json:"else,omitempty"`
+	Contains *SchemaProperty  `json:"contains,omitempty"`
+	Const    *any             `json:"const,omitempty"`
+	// AdditionalProperties is only set on objects; strict mode requires it to be false.
+	AdditionalProperties *bool `json:"additionalProperties,omitempty"`
+	// Nullable turns the type into a ["type","null"] union and adds null to enum/oneOf.
+	Nullable bool `json:"-"`
+}
+
+func (p SchemaProperty) MarshalJSON() ([]byte, error) {
+	type plain SchemaProperty
+	if !p.Nullable {
+		return json.Marshal(plain(p))
+	}
+	nullable := struct {
+		Type  []string `json:"type"`
+		Enum  []any    `json:"enum,omitempty"`
+		OneOf []OneOf  `json:"oneOf,omitempty"`
+		plain
+	}{
+		Type:  []string{p.Type, "null"},
+		plain: plain(p),
+	}
+	if p.Enum != nil {
+		for _, v := range *p.Enum {
+			nullable.Enum = append(nullable.Enum, v)
+		}
+		nullable.Enum = append(nullable.Enum, nil)
+	}
+	if p.OneOf != nil {
+		nullable.OneOf = append(append(nullable.OneOf, *p.OneOf...), OneOf{Const: nil, Title: "empty"})
+	}
+	return json.Marshal(nullable)
+}
+
+// UnmarshalJSON is the inverse of MarshalJSON: a ["type","null"] union and
+// null enum/oneOf entries set Nullable.
+func (p *SchemaProperty) UnmarshalJSON(data []byte) error {
+	type plain SchemaProperty
+	var raw struct {
+		Type  any   `json:"type"`
+		Enum  []any `json:"enum"`
+		OneOf []struct {
+			Const any    `json:"const"`
+			Title string `json:"title"`
+		} `json:"oneOf"`
+		plain
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*p = SchemaProperty(raw.plain)
+	switch t := raw.Type.(type) {
+	case string:
+		p.Type = t
+	case []any:
+		for _, item := range t {
+			if item == "null" {
+				p.Nullable = true
+			} else if s, ok := item.(string); ok {
+				p.Type = s
+			}
+		}
+	}
+	if raw.Enum != nil {
+		enum := make([]string, 0, len(raw.Enum))
+		for _, v := range raw.Enum {
+			if v == nil {
+				p.Nullable = true
+				continue
+			}
+			enum = append(enum, fmt.Sprint(v))
+		}
+		p.Enum = &enum
+	}
+	if raw.OneOf != nil {
+		oneOf := make([]OneOf, 0, len(raw.OneOf))
+		for _, o := range raw.OneOf {
+			if o.Const == nil {
+				continue
+			}
+			oneOf = append(oneOf, OneOf{Const: o.Const, Title: o.Title})
+		}
+		p.OneOf = &oneOf
+	}
+	return nil
+}
+
+// SchemaOptions controls how a form is converted into a JSON Schema.
+type SchemaOptions struct {
+	// MaxFilterOptions is the largest actor filter inlined as an enum.
+	// Bigger filters fall back to a plain string holding an actor ID.
+	MaxFilterOptions int
+	// Strict lists every field as required, as OpenAI strict mode demands,
+	// and makes the optional ones nullable so the model can leave them empty.
+	Strict bool
+	// NestSections emits one nested object per section instead of a flat
+	// object keyed by field ID.
+	NestSections bool
+	// Limits are checked by fitSchema; zero values fall back to defaultSchemaLimits.
+	Limits SchemaLimits
+	// ISODates asks for calendar fields as ISO 8601 strings instead of unixtime.
+	ISODates bool
+	// ReferenceTime resolves relative dates in ISODates mode; zero means now.
+	ReferenceTime time.Time
+	// Conditions is ConditionsDescribe or ConditionsIfThenElse.
+	Conditions string
+}
+
+// parseForm reads the form definition of a gitcall request.
+func parseForm(v any) (Form, error) {
+	var f Form
+	formJSON, ok := v.(map[string]any)
+	if formJSON == nil || !ok {
+		return f, fmt.Errorf("no form")
+	}
+	formBin, err := json.Marshal(formJSON)
+	if err != nil {
+		return f, err
+	}
+	err = json.Unmarshal(formBin, &f)
+	return f, err
+}
+
+// schemaOptions reads the conversion options of a gitcall request.
+// Strict mode is on unless the request turns it off.
+func schemaOptions(req map[string]any) (SchemaOptions, error) {
+	opts := SchemaOptions{Strict: true}
+	if strict, ok := req["strict"].(bool); ok {
+		opts.Strict = strict
+	}
+	if nest, ok := req["nest_sections"].(bool); ok {
+		opts.NestSections = nest
+	}
+	if maxOptions, ok := req["max_filter_options"].(float64); ok {
+		opts.MaxFilterOptions = int(maxOptions)
+	}
+	if limits, ok := req["limits"].(map[string]any); ok {
+		bin, _ := json.Marshal(limits)
+		_ = json.Unmarshal(bin, &opts.Limits)
+	}
+	if iso, ok := req["iso_dates"].(bool); ok {
+		opts.ISODates = iso
+	}
+	if ref, ok := req["reference_time"].(string); ok {
+		t, err := time.Parse(time.RFC3339, ref)
+		if err != nil {
+			return opts, fmt.Errorf("reference_time: %w", err)
+		}
+		opts.ReferenceTime = t
+	}
+	if conditions, ok := req["conditions"].(string); ok {
+		opts.Conditions = conditions
+	}
+	return opts, nil
+}
+
+// convertToJSONSchema builds the root object schema of the form. Fields that
+// cannot be converted are skipped and reported as diagnostics.
+func convertToJSONSchema(f Form, opts SchemaOptions) (SchemaProperty, []Diagnostic, error) {
+	conv := newConversion(opts)
+	root := conv.sectionsSchema(f.Sections)
+	return root, conv.diagnostics, nil
+}
+
+// sectionsSchema builds one object schema from the fields of sections. With
+// NestSections every section becomes a nested object keyed by sectionKeys.
+func (c *conversion) sectionsSchema(sections []Section) SchemaProperty {
+	return c.keyedSchema(sections, sectionKeys(sections))
+}
+
+// keyedSchema is sectionsSchema with the section keys given.
+func (c *conversion) keyedSchema(sections []Section, keys []string) SchemaProperty {
+	root := objectSchema()
+	c.index(sections, keys)
+	for i, section := range sections {
+		obj := &root
+		nested := objectSchema()
+		if c.opts.NestSections {
+			nested.Description = section.Title
+			obj = &nested
+		}
+		for _, item := range section.Content {
+			c.addField(obj, section.Title, item)
+		}
+		if c.opts.NestSections && len(nested.Properties) > 0 {
+			root.Properties[keys[i]] = nested
+			root.Required = append(root.Required, keys[i])
+		}
+	}
+	c.addConditions(&root)
+	return root
+}
+
+var nonKeyChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// sectionKeys returns the property names of sections in NestSections mode:
+// the section title in snake case, made unique by the section number.
+func sectionKeys(sections []Section) []string {
+	keys := make([]string, len(sections))
+	seen := make(map[string]bool, len(sections))
+	for i, section := range sections {
+		key := strings.Trim(nonKeyChars.ReplaceAllString(strings.ToLower(section.Title), "_"), "_")
+		if key == "" || seen[key] {
+			key = strings.TrimPrefix(key+"_", "_") + "section_" + strconv.Itoa(i+1)
+		}
+		seen[key] = true
+		keys[i] = key
+	}
+	return keys
+}
+
+func objectSchema() SchemaProperty {
+	return SchemaProperty{
+		Type:                 "object",
+		Properties:           make(map[string]SchemaProperty),
+		Required:             make([]string, 0),
+		AdditionalProperties: new(bool),
+	}
+}
+
+// addField converts item with its registered converter and adds it to obj.
+func (c *conversion) addField(obj *SchemaProperty, section string, item Content) {
+	if item.hidden() {
+		return
+	}
+	field := c.field(section, item)
+	if item.locked() {
+		field.Warn("locked field keeps its current value, left out")
+		return
+	}
+	converter, ok := fieldConverters[item.Class]
+	if !ok {
+		field.Warn("unknown item class %s, field skipped", item.Class)
+		return
+	}
+	schema, ok, err := converter.Schema(field)
+	if err != nil {
+		field.Warn("%v, field skipped", err)
+		return
+	}
+
+	// Используем ID элемента как ключ в схеме
+	if !ok || item.ID == "" {
+		return
+	}
+	if item.hasValue() {
+		schema.Description += ", current value: " + describeValue(item.Value) + ", keep it unless the text changes it"
+	}
+	if len(item.Conditions) > 0 {
+		schema.Description += ", " + c.describeConditions(item.Conditions)
+		schema.Nullable = true
+		c.conditional = append(c.conditional, conditionalField{item: item, schema: schema})
+	} else if !item.Required && c.opts.Strict {
+		schema.Nullable = true
+		schema.Description += ", null if not present in the text"
+	}
+	if item.Required && len(item.Conditions) == 0 || c.opts.Strict {
+		obj.Required = append(obj.Required, item.ID)
+	}
+	obj.Properties[item.ID] = schema
+}
+
+// itemCounts returns the minItems/maxItems bounds of a multiSelect field.
+// A required field needs at least one value; maxItems never exceeds the option count.
+func itemCounts(item Content, optionCount int) (*int, *int) {
+	var minItems, maxItems *int
+	if item.Extra != nil && item.Extra.Min != nil {
+		n := int(*item.Extra.Min)
+		minItems = &n
+	} else if item.Required {
+		n := 1
+		minItems = &n
+	}
+	if item.Extra != nil && item.Extra.Max != nil {
+		n := int(*item.Extra.Max)
+		if optionCount > 0 && n > optionCount {
+			n = optionCount
+		}
+		maxItems = &n
+	}
+	return minItems, maxItems
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFilter serves n actors through loadFilterPage for the duration of a test.
+func fakeFilter(t *testing.T, n int) *int {
+	calls := 0
+	prev := loadFilterPage
+	loadFilterPage = func(filterID string, limit, offset int) map[string]any {
+		calls++
+		list := make([]any, 0, limit)
+		for i := offset; i < n && i < offset+limit; i++ {
+			list = append(list, map[string]any{
+				"id":    fmt.Sprintf("actor-%d", i),
+				"title": fmt.Sprintf("Actor %d", i),
+			})
+		}
+		return map[string]any{"data": map[string]any{"list": list, "total": float64(n)}}
+	}
+	t.Cleanup(func() { loadFilterPage = prev })
+	return &calls
+}
+
+func filterForm() Form {
+	return Form{Sections: []Section{{
+		Title: "main",
+		Content: []Content{{
+			ID:    "owner",
+			Class: "select",
+			Title: "Owner",
+			Extra: &Extra{OptionsSource: &ExtraOptionsSource{
+				Type:  "actorFilter",
+				Value: ExtraValue{ID: "filter-1"},
+			}},
+		}},
+	}}}
+}
+
+func TestConvertToJSONSchema_ActorFilter(t *testing.T) {
+	calls := fakeFilter(t, 450)
+
+	root, _, err := convertToJSONSchema(filterForm(), SchemaOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 3, *calls)
+
+	owner := root.Properties["owner"]
+	require.Len(t, *owner.Enum, 450)
+	require.Equal(t, "actor-449", (*owner.Enum)[449])
+	require.Equal(t, OneOf{Const: "actor-0", Title: "Actor 0"}, (*owner.OneOf)[0])
+}
+
+func TestConvertToJSONSchema_ActorFilterTooLarge(t *testing.T) {
+	fakeFilter(t, 450)
+
+	root, _, err := convertToJSONSchema(filterForm(), SchemaOptions{MaxFilterOptions: 300})
+	require.NoError(t, err)
+
+	owner := root.Properties["owner"]
+	require.Nil(t, owner.Enum)
+	require.Nil(t, owner.OneOf)
+	require.Equal(t, "string", owner.Type)
+	require.Contains(t, owner.Description, "ID of an actor from filter filter-1")
+}
+
+func TestConvertToJSONSchema_MultiSelect(t *testing.T) {
+	max := 5.0
+	f := Form{Sections: []Section{{
+		Title: "main",
+		Content: []Content{{
+			ID:       "tags",
+			Class:    "multiSelect",
+			Title:    "Tags",
+			Required: true,
+			Options:  []Option{{Title: "Red", Value: "r"}, {Title: "Blue", Value: "b"}},
+			Extra:    &Extra{Max: &max},
+		}},
+	}}}
+
+	root, _, err := convertToJSONSchema(f, SchemaOptions{})
+	require.NoError(t, err)
+
+	tags := root.Properties["tags"]
+	require.Equal(t, "array", tags.Type)
+	require.True(t, tags.UniqueItems)
+	require.Equal(t, 1, *tags.MinItems)
+	require.Equal(t, 2, *tags.MaxItems)
+	require.Equal(t, []string{"r", "b"}, *tags.Items.Enum)
+
+	values, err := multiSelectValues([]any{"b", "r", "b"})
+	require.NoError(t, err)
+	data, err := selectFormValue(f.Sections[0].Content[0].Options, values)
+	require.NoError(t, err)
+	require.Equal(t, []map[string]any{
+		{"value": "b", "title": "Blue"},
+		{"value": "r", "title": "Red"},
+	}, data)
+
+	_, err = selectFormValue(f.Sections[0].Content[0].Options, []string{"g"})
+	require.Error(t, err)
+}
+
+func TestConvertToJSONSchema_StrictRequired(t *testing.T) {
+	f := Form{Sections: []Section{{
+		Title: "main",
+		Content: []Content{
+			{ID: "name", Class: "edit", Title: "Name", Required: true},
+			{ID: "color", Class: "select", Title: "Color", Options: []Option{{Title: "Red", Value: "r"}}},
+		},
+	}}}
+
+	root, _, err := convertToJSONSchema(f, SchemaOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"name"}, root.Required)
+
+	root, _, err = convertToJSONSchema(f, SchemaOptions{Strict: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"name", "color"}, root.Required)
+
+	bin, err := json.Marshal(root)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"type": "object",
+		"additionalProperties": false,
+		"required": ["name", "color"],
+		"properties": {
+			"name": {"type": "string", "description": "Section: main, field: Name"},
+			"color": {
+				"type": ["string", "null"],
+				"description": "Section: main, field: Color, null if not present in the text",
+				"enum": ["r", null],
+				"oneOf": [{"const": "r", "title": "Red"}, {"const": null, "title": "empty"}]
+			}
+		}
+	}`, string(bin))
+}
+
+type slugConverter struct{}
+
+func (slugConverter) Schema(f *Field) (SchemaProperty, bool, error) {
+	return SchemaProperty{Type: "string", Description: f.Description() + ", lowercase slug"}, true, nil
+}
+
+func (slugConverter) FormData(f *Field, raw any) (any, error) {
+	return raw, nil
+}
+
+func TestConvertToJSONSchema_UnknownClasses(t *testing.T) {
+	f := Form{Sections: []Section{{
+		Title: "main",
+		Content: []Content{
+			{ID: "name", Class: "edit", Title: "Name"},
+			{ID: "map", Class: "geoMap", Title: "Location"},
+			{ID: "kind", Class: "select", Title: "Kind", Extra: &Extra{OptionsSource: &ExtraOptionsSource{Type: "dictionary"}}},
+			{ID: "slug", Class: "slug", Title: "Slug"},
+		},
+	}}}
+
+	root, diagnostics, err := convertToJSONSchema(f, SchemaOptions{})
+	require.NoError(t, err)
+	require.Len(t, root.Properties, 1)
+	require.Equal(t, []Diagnostic{
+		{Field: "map", Class: "geoMap", Section: "main", Message: "unknown item class geoMap, field skipped"},
+		{Field: "kind", Class: "select", Section: "main", Message: "unknown extra options source type dictionary, field skipped"},
+		{Field: "slug", Class: "slug", Section: "main", Message: "unknown item class slug, field skipped"},
+	}, diagnostics)
+
+	RegisterFieldConverter("slug", slugConverter{})
+	t.Cleanup(func() { delete(fieldConverters, "slug") })
+
+	root, diagnostics, err = convertToJSONSchema(f, SchemaOptions{})
+	require.NoError(t, err)
+	require.Len(t, diagnostics, 2)
+	require.Equal(t, "Section: main, field: Slug, lowercase slug", root.Properties["slug"].Description)
+}
+
+func TestConvertToJSONSchema_ValuesAndVisibility(t *testing.T) {
+	f := Form{Sections: []Section{{
+		Title: "main",
+		Content: []Content{
+			{ID: "name", Class: "edit", Title: "Name", Value: "Acme"},
+			{ID: "color", Class: "select", Title: "Color", Options: []Option{{Title: "Red", Value: "r"}},
+				Value: []any{map[string]any{"value": "r", "title": "Red"}}},
+			{ID: "secret", Class: "edit", Title: "Secret", Visibility: "hidden"},
+			{ID: "code", Class: "edit", Title: "Code", Value: "X-1", IDNotChanged: true},
+			{ID: "owner", Class: "edit", Title: "Owner", Value: "Bob", Visibility: "readonly"},
+			{ID: "note", Class: "edit", Title: "Note", Visibility: "readonly"},
+		},
+	}}}
+
+	root, diagnostics, err := convertToJSONSchema(f, SchemaOptions{})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"name", "color", "note"}, keys(root.Properties))
+	require.Equal(t, `Section: main, field: Name, current value: "Acme", keep it unless the text changes it`, root.Properties["name"].Description)
+	require.Equal(t, `Section: main, field: Color, current value: "r", keep it unless the text changes it`, root.Properties["color"].Description)
+	require.Len(t, diagnostics, 2)
+
+	data, err := convertToFormData(f, map[string]any{"name": "Acme Inc"}, SchemaOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"name": "Acme Inc", "code": "X-1", "owner": "Bob"}, data)
+
+	_, err = convertToFormData(f, map[string]any{"secret": "s", "code": "X-2"}, SchemaOptions{})
+	require.EqualError(t, err, "code: unknown field\nsecret: unknown field")
+}
+
+func keys(m map[string]SchemaProperty) []string {
+	result := make([]string, 0, len(m))
+	for k := range m {
+		result = append(result, k)
+	}
+	return result
+}
+
+func TestConvertToJSONSchema_NestSections(t *testing.T) {
+	f := Form{Sections: []Section{
+		{Title: "Contact person", Content: []Content{{ID: "name", Class: "edit", Title: "Name", Required: true}}},
+		{Title: "Company", Content: []Content{{ID: "name", Class: "edit", Title: "Name"}}},
+		{Title: "Company", Content: []Content{{ID: "site", Class: "url", Title: "Site"}}},
+		{Title: "Files", Content: []Content{{ID: "file", Class: "upload", Title: "File"}}},
+	}}
+	require.Equal(t, []string{"contact_person", "company", "company_section_3", "files"}, sectionKeys(f.Sections))
+
+	root, _, err := convertToJSONSchema(f, SchemaOptions{NestSections: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"contact_person", "company", "company_section_3"}, root.Required)
+	require.Equal(t, "Company", root.Properties["company"].Description)
+	require.Equal(t, []string{"name"}, root.Properties["contact_person"].Required)
+	require.Contains(t, root.Properties["company_section_3"].Properties, "site")
+
+	data, err := convertToFormData(f, map[string]any{
+		"contact_person":    map[string]any{"name": "Ann"},
+		"company":           map[string]any{},
+		"company_section_3": map[string]any{"site": "https://acme.example"},
+	}, SchemaOptions{NestSections: true})
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"name": "Ann", "site": "https://acme.example"}, data)
+
+	_, err = convertToFormData(f, map[string]any{
+		"contact_person": map[string]any{"name": "Ann"},
+		"company":        map[string]any{"name": "Acme", "vat": "1"},
+	}, SchemaOptions{NestSections: true})
+	require.EqualError(t, err, "company/vat: unknown field\ncompany/name: field is filled in several sections")
+}
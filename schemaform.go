@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"graph_maker/aihands"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// defaultSectionTitle holds the top-level fields of a schema.
+const defaultSectionTitle = "main"
+
+// fieldDescription reads back the description convertToJSONSchema writes.
+var fieldDescription = regexp.MustCompile(`^Section: (.*?), field: ([^,]*)`)
+
+// currencyDescription reads back the currency of a currency field.
+var currencyDescription = regexp.MustCompile(`, amount in ([A-Z]{3})\b`)
+
+// schemaForm holds the state of one schema to form conversion.
+type schemaForm struct {
+	sections    []Section
+	index       map[string]int
+	diagnostics []Diagnostic
+}
+
+// convertToForm is the inverse of convertToJSONSchema: enums become selects,
+// booleans checks, date-times calendars, arrays of objects tables and nested
+// objects sections. Descriptions written by convertToJSONSchema give back the
+// section and field titles, so converted forms survive a round trip.
+func convertToForm(schema SchemaProperty, title string) (Form, []Diagnostic, error) {
+	if schema.Type != "object" {
+		return Form{}, nil, fmt.Errorf("expected an object schema, got %q", schema.Type)
+	}
+	if title == "" {
+		title = schema.Title
+	}
+	c := &schemaForm{index: make(map[string]int), diagnostics: make([]Diagnostic, 0)}
+	c.addObject(schema, "", "")
+	return Form{Title: title, Description: schema.Description, Sections: c.sections}, c.diagnostics, nil
+}
+
+func (c *schemaForm) section(title string) *Section {
+	i, ok := c.index[title]
+	if !ok {
+		i = len(c.sections)
+		c.index[title] = i
+		c.sections = append(c.sections, Section{Title: title})
+	}
+	return &c.sections[i]
+}
+
+// addObject adds the properties of an object schema in schema order.
+// Top-level objects become sections; deeper ones are flattened into their
+// section with prefixed field IDs.
+func (c *schemaForm) addObject(schema SchemaProperty, section, prefix string) {
+	for _, key := range propertyOrder(schema) {
+		property := schema.Properties[key]
+		required := contains(schema.Required, key) && !property.Nullable
+		if property.Type == "object" && property.Properties != nil && !isCalendarSchema(property) {
+			switch {
+			case section == "":
+				c.addObject(property, sectionTitle(key, property), "")
+			default:
+				c.addObject(property, section, prefix+key+"_")
+			}
+			continue
+		}
+		item := c.field(prefix+key, property, section)
+		item.Required = required
+		if section == "" {
+			if m := fieldDescription.FindStringSubmatch(property.Description); m != nil {
+				c.section(m[1]).Content = append(c.section(m[1]).Content, item)
+				continue
+			}
+			c.section(defaultSectionTitle).Content = append(c.section(defaultSectionTitle).Content, item)
+			continue
+		}
+		c.section(section).Content = append(c.section(section).Content, item)
+	}
+}
+
+// field maps one property onto a form field.
+func (c *schemaForm) field(id string, property SchemaProperty, section string) Content {
+	item := Content{ID: id, Title: propertyTitle(id, property)}
+	warn := func(format string, args ...any) {
+		c.diagnostics = append(c.diagnostics, Diagnostic{
+			Field: id, Class: item.Class, Section: section, Message: fmt.Sprintf(format, args...),
+		})
+	}
+	bounds := func() {
+		if property.Minimum != nil || property.Maximum != nil {
+			item.Extra = &Extra{Min: property.Minimum, Max: property.Maximum}
+		}
+	}
+
+	switch property.Type {
+	case "object":
+		if isCalendarSchema(property) {
+			item.Class = "calendar"
+			break
+		}
+		item.Class = "edit"
+		warn("object is kept as text")
+	case "boolean":
+		item.Class = "check"
+	case "integer", "number":
+		item.Class = "number"
+		bounds()
+		if m := currencyDescription.FindStringSubmatch(property.Description); m != nil {
+			item.Class = "currency"
+			if item.Extra == nil {
+				item.Extra = &Extra{}
+			}
+			item.Extra.Currency = m[1]
+		}
+		if property.Type == "integer" {
+			precision := 0
+			if item.Extra == nil {
+				item.Extra = &Extra{}
+			}
+			item.Extra.Precision = &precision
+		}
+	case "string":
+		switch {
+		case property.Enum != nil:
+			item.Class = "select"
+			item.Options = schemaOptionsList(property)
+		case property.Format == "date-time" || property.Format == "date":
+			item.Class = "calendar"
+		case property.Format == "email":
+			item.Class = "email"
+		case property.Format == "uri":
+			item.Class = "url"
+		case property.Pattern == phonePattern.String():
+			item.Class = "phone"
+		default:
+			item.Class = "edit"
+			if property.Pattern != "" {
+				warn("pattern %s is dropped", property.Pattern)
+			}
+		}
+	case "array":
+		switch {
+		case property.Items != nil && property.Items.Enum != nil:
+			item.Class = "multiSelect"
+			item.Options = schemaOptionsList(*property.Items)
+			if property.MinItems != nil || property.MaxItems != nil {
+				item.Extra = &Extra{Min: intFloat(property.MinItems), Max: intFloat(property.MaxItems)}
+			}
+		case property.Items != nil && property.Items.Type == "object":
+			item.Class = "table"
+			item.Extra = &Extra{Columns: c.columns(*property.Items, id, section)}
+		default:
+			item.Class = "edit"
+			warn("array of %s is kept as text", itemsType(property))
+		}
+	default:
+		item.Class = "edit"
+		warn("type %q is kept as text", property.Type)
+	}
+	return item
+}
+
+// columns maps the properties of a table row onto table columns.
+func (c *schemaForm) columns(row SchemaProperty, table, section string) []Content {
+	columns := make([]Content, 0, len(row.Properties))
+	for _, key := range propertyOrder(row) {
+		property := row.Properties[key]
+		if property.Type == "object" || property.Type == "array" {
+			c.diagnostics = append(c.diagnostics, Diagnostic{
+				Field: table + "/" + key, Section: section, Message: "nested " + property.Type + " in a table row is kept as text",
+			})
+			property = SchemaProperty{Type: "string", Description: property.Description, Title: property.Title}
+		}
+		column := c.field(key, property, section)
+		column.Required = contains(row.Required, key) && !property.Nullable
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// isCalendarSchema recognises the calendar objects of convertToJSONSchema.
+func isCalendarSchema(property SchemaProperty) bool {
+	_, unix := property.Properties["startDate"]
+	start, iso := property.Properties["start"]
+	return unix || iso && start.Format == "date-time"
+}
+
+// sectionTitle is the title of the section made of a nested object: the
+// schema title, the section named in the descriptions of its fields, or the
+// key in sentence case.
+func sectionTitle(key string, property SchemaProperty) string {
+	if property.Title != "" {
+		return property.Title
+	}
+	for _, name := range propertyOrder(property) {
+		if m := fieldDescription.FindStringSubmatch(property.Properties[name].Description); m != nil {
+			return m[1]
+		}
+	}
+	return propertyTitle(key, SchemaProperty{})
+}
+
+// propertyOrder is the required properties in schema order, then the rest by name.
+func propertyOrder(schema SchemaProperty) []string {
+	keys := make([]string, 0, len(schema.Properties))
+	for _, key := range schema.Required {
+		if _, ok := schema.Properties[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	rest := make([]string, 0, len(schema.Properties))
+	for key := range schema.Properties {
+		if !contains(schema.Required, key) {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
+// propertyTitle is the schema title, the field title of a description
+// written by convertToJSONSchema, or the key in sentence case.
+func propertyTitle(key string, property SchemaProperty) string {
+	if property.Title != "" {
+		return property.Title
+	}
+	if m := fieldDescription.FindStringSubmatch(property.Description); m != nil {
+		return m[2]
+	}
+	words := strings.Fields(strings.NewReplacer("_", " ", "-", " ").Replace(key))
+	if len(words) == 0 {
+		return key
+	}
+	title := []rune(strings.ToLower(strings.Join(words, " ")))
+	title[0] = unicode.ToUpper(title[0])
+	return string(title)
+}
+
+// schemaOptionsList turns an enum into select options, taking titles from oneOf.
+func schemaOptionsList(property SchemaProperty) []Option {
+	titles := make(map[string]string)
+	if property.OneOf != nil {
+		for _, o := range *property.OneOf {
+			titles[fmt.Sprint(o.Const)] = o.Title
+		}
+	}
+	options := make([]Option, 0, len(*property.Enum))
+	for _, v := range *property.Enum {
+		title := titles[v]
+		if title == "" {
+			title = v
+		}
+		options = append(options, Option{Title: title, Value: v})
+	}
+	return options
+}
+
+func itemsType(property SchemaProperty) string {
+	if property.Items == nil || property.Items.Type == "" {
+		return "any"
+	}
+	return property.Items.Type
+}
+
+func intFloat(n *int) *float64 {
+	if n == nil {
+		return nil
+	}
+	f := float64(*n)
+	return &f
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// templateSections turns form sections into the payload of aihands.CreateTemplate.
+func templateSections(f Form) ([]map[string]any, error) {
+	bin, err := json.Marshal(f.Sections)
+	if err != nil {
+		return nil, err
+	}
+	var sections []map[string]any
+	err = json.Unmarshal(bin, &sections)
+	return sections, err
+}
+
+// usercodeSchemaForm handles schema_form_req: it converts a JSON Schema into
+// a form and, when workspace_id is given, creates it as a template there that
+// the request's users can access.
+func usercodeSchemaForm(ctx context.Context, data1 map[string]any, sf map[string]any) error {
+	if sf["schema"] == nil {
+		return fmt.Errorf("no schema_form_req.schema")
+	}
+	schema, err := toSchemaProperty(sf["schema"])
+	if err != nil {
+		return fmt.Errorf("schema_form_req.schema: %w", err)
+	}
+	fail := func(err error) error {
+		data1["schema_form_rsp"] = map[string]any{
+			"status": "error",
+			"error":  err.Error(),
+		}
+		return fmt.Errorf("schema form: %w", err)
+	}
+	title, _ := sf["title"].(string)
+	f, diagnostics, err := convertToForm(schema, title)
+	if err != nil {
+		return fail(err)
+	}
+	rsp := map[string]any{
+		"form":        f,
+		"diagnostics": diagnostics,
+		"status":      "ok",
+	}
+	if wid, ok := sf["workspace_id"].(string); ok && wid != "" {
+		if f.Title == "" {
+			return fail(fmt.Errorf("no schema_form_req.title"))
+		}
+		list, _ := sf["users"].([]any)
+		users, err := parseUsers(list)
+		if err != nil {
+			return fail(err)
+		}
+		sections, err := templateSections(f)
+		if err != nil {
+			return fail(err)
+		}
+		if key, ok := sf["sim_api_key"].(string); ok {
+			aihands.Token = key
+		}
+		formID := aihands.CreateTemplate(wid, f.Title, sections)
+		grantTemplateAccess(formID, users)
+		rsp["form_id"] = formID
+	}
+	data1["schema_form_rsp"] = rsp
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertToForm(t *testing.T) {
+	schema, err := toSchemaProperty(map[string]any{
+		"type":     "object",
+		"title":    "Lead",
+		"required": []any{"full_name", "status"},
+		"properties": map[string]any{
+			"full_name": map[string]any{"type": "string"},
+			"status":    map[string]any{"type": "string", "enum": []any{"new", "won"}},
+			"vip":       map[string]any{"type": "boolean"},
+			"met_at":    map[string]any{"type": "string", "format": "date-time"},
+			"age":       map[string]any{"type": "integer", "minimum": 0},
+			"tags":      map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"company": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"name": map[string]any{"type": "string", "title": "Company name"}},
+			},
+		},
+	})
+	require.NoError(t, err)
+	f, diagnostics, err := convertToForm(schema, "")
+	require.NoError(t, err)
+	require.Equal(t, "Lead", f.Title)
+	require.Len(t, f.Sections, 2)
+	require.Equal(t, "main", f.Sections[0].Title)
+
+	classes := make(map[string]string)
+	for _, section := range f.Sections {
+		for _, item := range section.Content {
+			classes[item.ID] = item.Class
+		}
+	}
+	require.Equal(t, map[string]string{
+		"full_name": "edit", "status": "select", "vip": "check", "met_at": "calendar",
+		"age": "number", "tags": "edit", "name": "edit",
+	}, classes)
+	require.Equal(t, Content{ID: "full_name", Class: "edit", Title: "Full name", Required: true}, f.Sections[0].Content[0])
+	require.Equal(t, []Option{{Title: "new", Value: "new"}, {Title: "won", Value: "won"}}, f.Sections[0].Content[1].Options)
+	require.Equal(t, Section{Title: "Company", Content: []Content{{ID: "name", Class: "edit", Title: "Company name"}}}, f.Sections[1])
+	require.Equal(t, []Diagnostic{{Field: "tags", Class: "edit", Section: "", Message: "array of string is kept as text"}}, diagnostics)
+}
+
+func TestConvertToForm_RoundTrip(t *testing.T) {
+	for _, nest := range []bool{false, true} {
+		f := classesForm()
+		schema, _, err := convertToJSONSchema(f, SchemaOptions{Strict: true, NestSections: nest})
+		require.NoError(t, err)
+		back, _, err := convertToForm(schema, "")
+		require.NoError(t, err)
+		again, _, err := convertToJSONSchema(back, SchemaOptions{Strict: true, NestSections: nest})
+		require.NoError(t, err)
+		expected, err := json.Marshal(schema)
+		require.NoError(t, err)
+		requireJSON(t, string(expected), again)
+	}
+}
+
+func TestUserCode_SchemaFormErrors(t *testing.T) {
+	schema := map[string]any{"type": "object", "properties": map[string]any{"name": map[string]any{"type": "string"}}}
+	data := map[string]any{}
+	err := usercodeSchemaForm(context.Background(), data, map[string]any{"schema": schema, "workspace_id": "w1"})
+	require.EqualError(t, err, "schema form: no schema_form_req.title")
+	require.Equal(t, map[string]any{"status": "error", "error": "no schema_form_req.title"}, data["schema_form_rsp"])
+
+	data = map[string]any{}
+	err = usercodeSchemaForm(context.Background(), data, map[string]any{
+		"schema": schema, "title": "Person", "workspace_id": "w1", "users": []any{"x"},
+	})
+	require.ErrorContains(t, err, "failed to parse user ID")
+	require.Equal(t, "error", data["schema_form_rsp"].(map[string]any)["status"])
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidationError is a single mismatch between a value and its schema.
+// Path is a JSON pointer into the validated value.
+type ValidationError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return path + ": " + e.Message
+}
+
+// validateSchema checks value against the JSON Schema subset produced by
+// convertToJSONSchema: type, nullable, enum/oneOf, anyOf, required,
+// additionalProperties, items, uniqueItems, min/max items, minimum/maximum,
+// pattern, format and the allOf/if/then/else/contains/const of conditions.
+func validateSchema(schema SchemaProperty, value any) []ValidationError {
+	var errs []ValidationError
+	validateValue(schema, value, "", &errs)
+	return errs
+}
+
+func validateValue(schema SchemaProperty, value any, path string, errs *[]ValidationError) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if value == nil {
+		if !schema.Nullable && schema.Type != "null" {
+			fail("expected %s, got null", schema.Type)
+		}
+		return
+	}
+	if schema.AnyOf != nil {
+		if branch, branchErrs := closestBranch(schema.AnyOf, value, path); branch < 0 {
+			fail("matches no anyOf option")
+		} else if len(branchErrs) > 0 {
+			*errs = append(*errs, branchErrs...)
+		}
+	}
+	for _, clause := range schema.AllOf {
+		validateValue(clause, value, path, errs)
+	}
+	if schema.If != nil {
+		if len(validateSchema(*schema.If, value)) == 0 {
+			if schema.Then != nil {
+				validateValue(*schema.Then, value, path, errs)
+			}
+		} else if schema.Else != nil {
+			validateValue(*schema.Else, value, path, errs)
+		}
+	}
+	if schema.Const != nil && !reflect.DeepEqual(*schema.Const, value) {
+		fail("%v is not %v", value, *schema.Const)
+	}
+	if schema.Type != "" && !hasType(schema.Type, value) {
+		fail("expected %s, got %s", schema.Type, jsonType(value))
+		return
+	}
+	if schema.Enum != nil && !containsValue(*schema.Enum, value) {
+		fail("%v is not one of %s", value, strings.Join(*schema.Enum, ", "))
+	} else if schema.Enum == nil && schema.OneOf != nil && !matchesOneOf(*schema.OneOf, value) {
+		fail("%v matches no oneOf option", value)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range schema.Required {
+			if _, ok := v[key]; !ok {
+				*errs = append(*errs, ValidationError{Path: pointer(path, key), Message: "required property is missing"})
+			}
+		}
+		for _, key := range sortedKeys(v) {
+			property, ok := schema.Properties[key]
+			if !ok {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					*errs = append(*errs, ValidationError{Path: pointer(path, key), Message: "additional property is not allowed"})
+				}
+				continue
+			}
+			validateValue(property, v[key], pointer(path, key), errs)
+		}
+	case []any:
+		if schema.MinItems != nil && len(v) < *schema.MinItems {
+			fail("expected at least %d items, got %d", *schema.MinItems, len(v))
+		}
+		if schema.MaxItems != nil && len(v) > *schema.MaxItems {
+			fail("expected at most %d items, got %d", *schema.MaxItems, len(v))
+		}
+		if schema.Contains != nil && !containsMatch(*schema.Contains, v) {
+			fail("no item matches contains")
+		}
+		seen := make(map[string]bool, len(v))
+		for i, item := range v {
+			if schema.UniqueItems {
+				key := fmt.Sprintf("%#v", item)
+				if seen[key] {
+					fail("item %d is a duplicate", i)
+				}
+				seen[key] = true
+			}
+			if schema.Items != nil {
+				validateValue(*schema.Items, item, pointer(path, strconv.Itoa(i)), errs)
+			}
+		}
+	case float64:
+		if schema.Minimum != nil && v < *schema.Minimum {
+			fail("%v is less than %v", v, *schema.Minimum)
+		}
+		if schema.Maximum != nil && v > *schema.Maximum {
+			fail("%v is greater than %v", v, *schema.Maximum)
+		}
+	case string:
+		if schema.Pattern != "" {
+			re, err := regexp.Compile(schema.Pattern)
+			if err == nil && !re.MatchString(v) {
+				fail("%q does not match %s", v, schema.Pattern)
+			}
+		}
+		if err := checkFormat(schema.Format, v); err != nil {
+			fail("%v", err)
+		}
+	}
+}
+
+// closestBranch returns the anyOf branch value matches best together with its
+// errors, or -1 if there are no branches.
+func closestBranch(branches []SchemaProperty, value any, path string) (int, []ValidationError) {
+	best := -1
+	var bestErrs []ValidationError
+	for i, branch := range branches {
+		var errs []ValidationError
+		validateValue(branch, value, path, &errs)
+		if best < 0 || len(errs) < len(bestErrs) {
+			best, bestErrs = i, errs
+		}
+		if len(errs) == 0 {
+			break
+		}
+	}
+	return best, bestErrs
+}
+
+func containsMatch(schema SchemaProperty, items []any) bool {
+	for _, item := range items {
+		if len(validateSchema(schema, item)) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func hasType(t string, value any) bool {
+	switch t {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return jsonType(value) == t
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func containsValue(enum []string, value any) bool {
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+	for _, e := range enum {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesOneOf(oneOf []OneOf, value any) bool {
+	for _, o := range oneOf {
+		if o.Const == value {
+			return true
+		}
+	}
+	return false
+}
+
+func checkFormat(format, s string) error {
+	switch format {
+	case "email":
+		return checkEmail(s)
+	case "uri":
+		return checkURL(s)
+	}
+	return nil
+}
+
+// pointer appends an escaped JSON pointer token to path.
+func pointer(path, token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	token = strings.ReplaceAll(token, "/", "~1")
+	return path + "/" + token
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// repairValue fixes the mistakes models commonly make before validation:
+// unknown properties are dropped, missing nullable properties become null,
+// numbers and booleans sent as strings are parsed, enum values are matched
+// case-insensitively and fields whose conditions do not hold are set to
+// null. Anything it cannot fix is left for validateSchema.
+func repairValue(schema SchemaProperty, value any) any {
+	if schema.AnyOf != nil {
+		// Repair against every branch and keep the one that fits best.
+		var best any
+		bestErrs := -1
+		for _, branch := range schema.AnyOf {
+			repaired := repairValue(branch, value)
+			if errs := validateSchema(branch, repaired); bestErrs < 0 || len(errs) < bestErrs {
+				best, bestErrs = repaired, len(errs)
+			}
+		}
+		if bestErrs >= 0 {
+			return best
+		}
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		if schema.Type != "object" {
+			return value
+		}
+		repaired := make(map[string]any, len(v))
+		for key, item := range v {
+			property, ok := schema.Properties[key]
+			if !ok {
+				if schema.AdditionalProperties == nil || *schema.AdditionalProperties {
+					repaired[key] = item
+				}
+				continue
+			}
+			repaired[key] = repairValue(property, item)
+		}
+		for _, key := range schema.Required {
+			if _, ok := repaired[key]; !ok && schema.Properties[key].Nullable {
+				repaired[key] = nil
+			}
+		}
+		nullUnmet(schema, repaired)
+		return repaired
+	case []any:
+		if schema.Items == nil {
+			return value
+		}
+		repaired := make([]any, 0, len(v))
+		for _, item := range v {
+			repaired = append(repaired, repairValue(*schema.Items, item))
+		}
+		return repaired
+	case string:
+		switch schema.Type {
+		case "number", "integer":
+			if n, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return n
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b
+			}
+		case "string":
+			if schema.Enum != nil && !containsValue(*schema.Enum, v) {
+				for _, e := range *schema.Enum {
+					if strings.EqualFold(e, strings.TrimSpace(v)) {
+						return e
+					}
+				}
+			}
+		}
+	}
+	return value
+}
+
+// toSchemaProperty reads a JSON Schema produced elsewhere, e.g. by the
+// jsonschema reflector, into a SchemaProperty so it can be validated against.
+func toSchemaProperty(schema any) (SchemaProperty, error) {
+	var property SchemaProperty
+	bin, err := json.Marshal(schema)
+	if err != nil {
+		return property, err
+	}
+	err = json.Unmarshal(bin, &property)
+	return property, err
+}
+
+// checkResponse decodes a model response given either as a JSON string or as
+// an already decoded value, optionally repairs it and validates it.
+func checkResponse(schema SchemaProperty, response any, repair bool) (any, []ValidationError, error) {
+	if content, ok := response.(string); ok {
+		if err := json.Unmarshal([]byte(content), &response); err != nil {
+			return nil, nil, err
+		}
+	}
+	if repair {
+		response = repairValue(schema, response)
+	}
+	return response, validateSchema(schema, response), nil
+}
+
+func joinValidationErrors(errs []ValidationError) error {
+	list := make([]error, 0, len(errs))
+	for _, err := range errs {
+		list = append(list, err)
+	}
+	return errors.Join(list...)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSchema(t *testing.T) {
+	f := classesForm()
+	f.Sections[0].Content = append(f.Sections[0].Content,
+		Content{ID: "due", Class: "calendar", Title: "Due"},
+		Content{ID: "a/b", Class: "check", Title: "Slash", Required: true},
+	)
+	schema, _, err := convertToJSONSchema(f, SchemaOptions{Strict: true})
+	require.NoError(t, err)
+
+	errs := validateSchema(schema, map[string]any{
+		"qty":   1.5,
+		"price": 10.0,
+		"score": 9.0,
+		"mail":  "a@example.com",
+		"site":  "https://example.com",
+		"tel":   "+15551234567",
+		"stage": "lost",
+		"items": []any{map[string]any{"sku": "A", "count": nil, "color": "red"}},
+		"due":   map[string]any{"startDate": 1.0, "endDate": "tomorrow", "timeZoneOffset": 0.0},
+		"a/b":   nil,
+		"extra": true,
+	})
+	require.Equal(t, []string{
+		"/a~1b: expected boolean, got null",
+		"/due/endDate: expected integer, got string",
+		"/extra: additional property is not allowed",
+		"/items/0/color: additional property is not allowed",
+		"/qty: expected integer, got number",
+		"/score: 9 is greater than 5",
+		"/stage: lost is not one of won",
+	}, errorStrings(errs))
+}
+
+func TestRepairValue(t *testing.T) {
+	schema, _, err := convertToJSONSchema(classesForm(), SchemaOptions{Strict: true})
+	require.NoError(t, err)
+	schema.Properties["done"] = SchemaProperty{Type: "boolean", Nullable: true}
+	schema.Required = append(schema.Required, "done")
+
+	response, errs, err := checkResponse(schema, `{
+		"qty": "3", "price": 10, "score": 4, "mail": "a@example.com", "site": "https://example.com",
+		"tel": "+15551234567", "stage": "WON", "items": [{"sku": "A", "count": "2", "note": "x"}],
+		"comment": "dropped"
+	}`, true)
+	require.NoError(t, err)
+	require.Empty(t, errs)
+	require.Equal(t, map[string]any{
+		"qty": 3.0, "price": 10.0, "score": 4.0, "mail": "a@example.com", "site": "https://example.com",
+		"tel": "+15551234567", "stage": "won", "items": []any{map[string]any{"sku": "A", "count": 2.0}},
+		"done": nil,
+	}, response)
+}
+
+func TestParseGraph(t *testing.T) {
+	graph, err := parseGraph(graphSchema, `{"nodes": [{"id": "1", "name": "Ilona", "type": "person", "description": "",
+		"attributes": [{"key": "role", "value": "CEO"}], "x": 0, "y": "3"}], "edges": []}`)
+	require.NoError(t, err)
+	require.Equal(t, Graph{Nodes: []Node{{ID: "1", Name: "Ilona", Type: "person", Description: "",
+		Attributes: []Attribute{{Key: "role", Value: "CEO"}}, Y: 3}}, Edges: []Edge{}}, graph)
+
+	_, err = parseGraph(graphSchema, `{"nodes": [{"id": "1", "name": "Ilona", "type": "person", "description": "", "attributes": [], "x": 0}]}`)
+	require.EqualError(t, err, "invalid graph: /edges: required property is missing\n/nodes/0/y: required property is missing")
+}
+
+func errorStrings(errs []ValidationError) []string {
+	result := make([]string, 0, len(errs))
+	for _, err := range errs {
+		result = append(result, err.Error())
+	}
+	return result
+}